@@ -12,7 +12,9 @@ import (
 	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -77,7 +79,9 @@ func addLabel(img *image.RGBA, x, y int, label string) {
 // Simple end-to-end latency test
 func runEndToEndTest() {
 	fmt.Println("\n=== End-to-End Latency Test ===")
-	fmt.Println("This test measures the time from file write to stream receipt\n")
+	fmt.Println("This test measures the time from file write to stream receipt, using")
+	fmt.Println("the frame timestamps the server sends with each multipart part")
+	fmt.Println()
 
 	// Create initial image
 	generator := &ImageGenerator{}
@@ -107,10 +111,12 @@ func runEndToEndTest() {
 	fmt.Println("Consuming initial frame...")
 	reader.NextPart()
 
-	fmt.Println("\nWrite Time              | Receive Time            | Latency (ms)")
-	fmt.Println("------------------------|-------------------------|-------------")
+	fmt.Println("\nSeq    | Write Time      | Write→Cache (ms) | Cache→Receive (ms) | End-to-end (ms)")
+	fmt.Println("-------|-----------------|------------------|--------------------|----------------")
 
 	var latencies []time.Duration
+	var lastSeq uint64
+	dropped := 0
 
 	// Do 10 test writes and measure latency
 	for i := 0; i < 10; i++ {
@@ -125,16 +131,33 @@ func runEndToEndTest() {
 			continue
 		}
 
-		io.ReadAll(part) // Consume the data
+		// Read exactly Content-Length bytes: reading to the end of the part
+		// would wait for the next part's boundary, i.e. the next frame
+		length, _ := strconv.Atoi(part.Header.Get("Content-Length"))
+		io.ReadFull(part, make([]byte, length))
 		receiveTime := time.Now()
 
-		latency := receiveTime.Sub(writeTime)
+		// The part headers carry the file's mtime and when the server
+		// cached it, which splits the latency into detection and delivery
+		frame, err := parseFrameHeaders(part.Header)
+		if err != nil {
+			log.Printf("Part has no frame metadata, is the server up to date? %v", err)
+			continue
+		}
+		if lastSeq != 0 && frame.seq > lastSeq+1 {
+			dropped += int(frame.seq - lastSeq - 1)
+		}
+		lastSeq = frame.seq
+
+		latency := receiveTime.Sub(frame.modTime)
 		latencies = append(latencies, latency)
 
-		fmt.Printf("%s | %s | %8.2f ms\n",
+		fmt.Printf("%6d | %s | %16.2f | %18.2f | %15.2f\n",
+			frame.seq,
 			writeTime.Format("15:04:05.000000"),
-			receiveTime.Format("15:04:05.000000"),
-			float64(latency.Microseconds())/1000.0)
+			milliseconds(frame.cachedAt.Sub(frame.modTime)),
+			milliseconds(receiveTime.Sub(frame.cachedAt)),
+			milliseconds(latency))
 
 		time.Sleep(150 * time.Millisecond) // Wait between tests
 	}
@@ -162,7 +185,34 @@ func runEndToEndTest() {
 		fmt.Printf("Max:     %8.2f ms\n", float64(max.Microseconds())/1000.0)
 		fmt.Printf("Average: %8.2f ms\n", float64(avg.Microseconds())/1000.0)
 		fmt.Printf("Samples: %d\n", len(latencies))
+		fmt.Printf("Dropped: %d\n", dropped)
+	}
+}
+
+// frameHeaders is the per-frame metadata the server sends with each part.
+type frameHeaders struct {
+	seq      uint64
+	modTime  time.Time
+	cachedAt time.Time
+}
+
+func parseFrameHeaders(header textproto.MIMEHeader) (frameHeaders, error) {
+	var f frameHeaders
+	var err error
+	if f.seq, err = strconv.ParseUint(header.Get("X-Frame-Seq"), 10, 64); err != nil {
+		return f, fmt.Errorf("invalid X-Frame-Seq: %w", err)
+	}
+	if f.modTime, err = time.Parse(time.RFC3339Nano, header.Get("X-Frame-Timestamp")); err != nil {
+		return f, fmt.Errorf("invalid X-Frame-Timestamp: %w", err)
 	}
+	if f.cachedAt, err = time.Parse(time.RFC3339Nano, header.Get("X-Cache-Timestamp")); err != nil {
+		return f, fmt.Errorf("invalid X-Cache-Timestamp: %w", err)
+	}
+	return f, nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000.0
 }
 
 func main() {
@@ -0,0 +1,100 @@
+// Command shmring_writer is a reference producer for the shared-memory ring
+// source. It writes JPEG files given on the command line in a loop, or a
+// generated test pattern when there are none:
+//
+//	go run ./cmd/shmring_writer -path /dev/shm/bs-frames frame1.jpg frame2.jpg
+//	./bs-image-stream-server -source shm:/dev/shm/bs-frames
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bs-frame-monitor/pkg/shmring"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+func main() {
+	var (
+		path     = flag.String("path", "/dev/shm/bs-frames", "Ring file to create")
+		slots    = flag.Int("slots", 4, "Number of frame slots in the ring")
+		slotSize = flag.Int("slot-size", 4*1024*1024, "Maximum frame size in bytes")
+		fps      = flag.Float64("fps", 30, "Frames written per second")
+	)
+	flag.Parse()
+
+	var files [][]byte
+	for _, name := range flag.Args() {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", name, err)
+		}
+		files = append(files, data)
+	}
+
+	writer, err := shmring.Create(*path, *slots, *slotSize)
+	if err != nil {
+		log.Fatalf("Failed to create ring: %v", err)
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / *fps))
+	defer ticker.Stop()
+
+	log.Printf("Writing frames to %s at %.1f fps", *path, *fps)
+	for n := 0; ; n++ {
+		select {
+		case <-c:
+			writer.Close()
+			// Removing the ring tells readers the producer has gone away
+			os.Remove(*path)
+			return
+		case <-ticker.C:
+		}
+
+		var frame []byte
+		if len(files) > 0 {
+			frame = files[n%len(files)]
+		} else if frame, err = testPattern(n); err != nil {
+			log.Fatalf("Failed to generate frame: %v", err)
+		}
+
+		if _, err := writer.Write(frame, time.Now()); err != nil {
+			log.Printf("Skipped frame %d: %v", n, err)
+		}
+	}
+}
+
+func testPattern(n int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	bg := color.RGBA{uint8(n * 3), uint8(n * 5), uint8(n * 7), 255}
+	draw.Draw(img, img.Bounds(), &image.Uniform{bg}, image.Point{}, draw.Src)
+
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.White,
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(20, 40),
+	}
+	d.DrawString(fmt.Sprintf("Frame %d  %s", n, time.Now().Format("15:04:05.000")))
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -14,10 +14,11 @@ import (
 	"github.com/bs-frame-monitor/internal/cache"
 	"github.com/bs-frame-monitor/internal/monitor"
 	"github.com/bs-frame-monitor/internal/server"
+	"github.com/bs-frame-monitor/internal/testutil"
 )
 
 func createTestJPEG(content string) []byte {
-	return []byte(fmt.Sprintf("FAKE_JPEG_HEADER_%s_END", content))
+	return testutil.WrapJPEG([]byte(fmt.Sprintf("FAKE_JPEG_HEADER_%s_END", content)))
 }
 
 func TestFullSystemIntegration(t *testing.T) {
@@ -199,7 +200,8 @@ func TestSystemResourceUsage(t *testing.T) {
 	tmpDir := t.TempDir()
 	testFile := filepath.Join(tmpDir, "resource_test.jpg")
 
-	largeContent := bytes.Repeat([]byte("LARGE_IMAGE_DATA"), 10000)
+	largePayload := bytes.Repeat([]byte("LARGE_IMAGE_DATA"), 10000)
+	largeContent := testutil.WrapJPEG(largePayload)
 	if err := os.WriteFile(testFile, largeContent, 0644); err != nil {
 		t.Fatalf("Failed to create large test file: %v", err)
 	}
@@ -213,7 +215,7 @@ func TestSystemResourceUsage(t *testing.T) {
 	time.Sleep(time.Millisecond * 100)
 
 	for i := 0; i < 100; i++ {
-		updatedContent := append(largeContent, byte(i))
+		updatedContent := testutil.WrapJPEG(append(largePayload, byte(i)))
 		if err := os.WriteFile(testFile, updatedContent, 0644); err != nil {
 			t.Fatalf("Failed to update file: %v", err)
 		}
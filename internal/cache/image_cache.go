@@ -1,56 +1,317 @@
 package cache
 
 import (
+	"bytes"
 	"fmt"
+	"hash/crc64"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	DefaultHistoryFrames = 1
+	DefaultHistoryBytes  = 0
+)
+
+var hashTable = crc64.MakeTable(crc64.ECMA)
+
+// Frame is a single cached image. Frames are immutable once published, so
+// every reader shares the same Frame and its Data without copying. Callers
+// must treat Data as read-only.
+type Frame struct {
+	Seq        uint64
+	Data       []byte
+	ETag       string
+	Hash       string
+	ModTime    time.Time
+	CapturedAt time.Time
+	Size       int64
+	// Metadata is JSON describing the frame, such as detection results
+	// from a sidecar file, or nil when the frame has none.
+	Metadata []byte
+}
+
+// ImageCache publishes the latest frame through an atomic pointer so the hot
+// read path never takes a lock or copies image data. The mutex only guards the
+// history ring and subscriber set.
 type ImageCache struct {
+	latest   atomic.Pointer[Frame]
+	rejected atomic.Uint64
 	mu       sync.RWMutex
-	data     []byte
-	modTime  time.Time
-	etag     string
-	fileSize int64
+	ring     []*Frame
+	start    int
+	count    int
+	bytes    int64
+	maxBytes int64
+	nextSeq  uint64
+	subs     map[*Subscription]struct{}
+
+	// Source state reported by Status
+	source     string
+	missing    bool
+	lastSeen   time.Time
+	staleAfter time.Duration
+	producers  map[string]Producer
+}
+
+// Subscription signals on C whenever a new frame is stored in the cache.
+// Signals are coalesced: a subscriber that falls behind sees a single pending
+// notification and should read the latest frame with Latest.
+type Subscription struct {
+	C     <-chan struct{}
+	ch    chan struct{}
+	cache *ImageCache
 }
 
 func NewImageCache() *ImageCache {
-	return &ImageCache{}
+	return NewImageCacheWithHistory(DefaultHistoryFrames, DefaultHistoryBytes)
+}
+
+// NewImageCacheWithHistory creates a cache that keeps up to maxFrames recent
+// frames, evicting the oldest ones once their combined size exceeds maxBytes.
+// A maxBytes of zero disables the memory budget. The latest frame is always
+// retained regardless of either limit.
+func NewImageCacheWithHistory(maxFrames int, maxBytes int64) *ImageCache {
+	if maxFrames < 1 {
+		maxFrames = 1
+	}
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	return &ImageCache{
+		ring:     make([]*Frame, maxFrames),
+		maxBytes: maxBytes,
+		subs:     make(map[*Subscription]struct{}),
+	}
+}
+
+// ContentHash returns the hex-encoded content hash used for frame ETags and
+// change detection.
+func ContentHash(data []byte) string {
+	return fmt.Sprintf("%016x", crc64.Checksum(data, hashTable))
 }
 
-func (c *ImageCache) Update(data []byte, modTime time.Time, fileSize int64) {
+// Update publishes data as a new frame. Data that is byte-identical to the
+// latest frame is not counted as a new frame, and Update reports false.
+func (c *ImageCache) Update(data []byte, modTime time.Time, fileSize int64) bool {
+	return c.UpdateWithMetadata(data, nil, modTime, fileSize)
+}
+
+// UpdateWithMetadata is Update for a frame that comes with JSON metadata,
+// which is stored on the frame. A frame is new if either its data or its
+// metadata changed.
+func (c *ImageCache) UpdateWithMetadata(data, metadata []byte, modTime time.Time, fileSize int64) bool {
+	hash := ContentHash(data)
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.data = make([]byte, len(data))
-	copy(c.data, data)
-	c.modTime = modTime
-	c.fileSize = fileSize
-	c.etag = fmt.Sprintf("\"%d-%d\"", modTime.Unix(), fileSize)
+	// Even an unchanged frame proves the source is alive
+	c.lastSeen = time.Now()
+	c.missing = false
+
+	if latest := c.latest.Load(); latest != nil && latest.Hash == hash && len(latest.Data) == len(data) &&
+		bytes.Equal(latest.Metadata, metadata) {
+		return false
+	}
+
+	dataCopy := make([]byte, len(data))
+	copy(dataCopy, data)
+	var metadataCopy []byte
+	if metadata != nil {
+		metadataCopy = append([]byte(nil), metadata...)
+	}
+
+	c.nextSeq++
+	frame := &Frame{
+		Seq:        c.nextSeq,
+		Data:       dataCopy,
+		ETag:       "\"" + hash + "\"",
+		Hash:       hash,
+		ModTime:    modTime,
+		CapturedAt: c.lastSeen,
+		Size:       fileSize,
+		Metadata:   metadataCopy,
+	}
+
+	c.push(frame)
+	c.latest.Store(frame)
+	c.notify()
+	return true
 }
 
-func (c *ImageCache) Get() ([]byte, string, time.Time, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+// SetMetadata attaches JSON metadata to the retained frame with the given
+// sequence number, for metadata that arrives after its frame. Frames are
+// immutable, so the frame is replaced by a copy; subscribers are notified
+// if it is the latest. It reports false if the frame is no longer retained.
+func (c *ImageCache) SetMetadata(seq uint64, metadata []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	if c.data == nil {
-		return nil, "", time.Time{}, false
+	for i := 0; i < c.count; i++ {
+		idx := (c.start + i) % len(c.ring)
+		old := c.ring[idx]
+		if old.Seq != seq {
+			continue
+		}
+
+		frame := *old
+		frame.Metadata = append([]byte(nil), metadata...)
+		c.ring[idx] = &frame
+		if c.latest.Load() == old {
+			c.latest.Store(&frame)
+			c.notify()
+		}
+		return true
 	}
+	return false
+}
 
-	dataCopy := make([]byte, len(c.data))
-	copy(dataCopy, c.data)
+// Subscribe registers for new-frame notifications. The subscription must be
+// closed when no longer needed.
+func (c *ImageCache) Subscribe() *Subscription {
+	ch := make(chan struct{}, 1)
+	sub := &Subscription{C: ch, ch: ch, cache: c}
+
+	c.mu.Lock()
+	c.subs[sub] = struct{}{}
+	c.mu.Unlock()
 
-	return dataCopy, c.etag, c.modTime, true
+	return sub
+}
+
+func (s *Subscription) Close() {
+	s.cache.mu.Lock()
+	delete(s.cache.subs, s)
+	s.cache.mu.Unlock()
+}
+
+// notify wakes every subscriber without blocking. Callers must hold c.mu.
+func (c *ImageCache) notify() {
+	for sub := range c.subs {
+		select {
+		case sub.ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// push appends a frame to the history ring and evicts the oldest frames that
+// no longer fit in the count or memory budget. Callers must hold c.mu.
+func (c *ImageCache) push(frame *Frame) {
+	if c.count == len(c.ring) {
+		c.evictOldest()
+	}
+	c.ring[(c.start+c.count)%len(c.ring)] = frame
+	c.count++
+	c.bytes += int64(len(frame.Data))
+
+	for c.maxBytes > 0 && c.bytes > c.maxBytes && c.count > 1 {
+		c.evictOldest()
+	}
+}
+
+func (c *ImageCache) evictOldest() {
+	oldest := c.ring[c.start]
+	c.ring[c.start] = nil
+	c.start = (c.start + 1) % len(c.ring)
+	c.count--
+	c.bytes -= int64(len(oldest.Data))
+}
+
+// Get returns the latest frame's data, ETag and modification time. The
+// returned slice is shared with other readers and must not be modified.
+func (c *ImageCache) Get() ([]byte, string, time.Time, bool) {
+	frame := c.latest.Load()
+	if frame == nil {
+		return nil, "", time.Time{}, false
+	}
+	return frame.Data, frame.ETag, frame.ModTime, true
+}
+
+// Latest returns the most recent frame. The frame is shared with other
+// readers and its Data must not be modified.
+func (c *ImageCache) Latest() (*Frame, bool) {
+	frame := c.latest.Load()
+	return frame, frame != nil
 }
 
 func (c *ImageCache) GetETag() string {
+	if frame := c.latest.Load(); frame != nil {
+		return frame.ETag
+	}
+	return ""
+}
+
+func (c *ImageCache) HasData() bool {
+	return c.latest.Load() != nil
+}
+
+// RecordRejected counts a frame that a source discarded as corrupt or
+// incomplete instead of publishing it.
+func (c *ImageCache) RecordRejected() {
+	c.rejected.Add(1)
+}
+
+// Rejected returns the number of frames discarded by sources.
+func (c *ImageCache) Rejected() uint64 {
+	return c.rejected.Load()
+}
+
+// History returns the retained frames ordered from oldest to newest.
+func (c *ImageCache) History() []*Frame {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.etag
+
+	frames := make([]*Frame, 0, c.count)
+	for i := 0; i < c.count; i++ {
+		frames = append(frames, c.ring[(c.start+i)%len(c.ring)])
+	}
+	return frames
 }
 
-func (c *ImageCache) HasData() bool {
+// FramesSince returns the retained frames captured strictly after t, ordered
+// from oldest to newest.
+func (c *ImageCache) FramesSince(t time.Time) []*Frame {
+	var frames []*Frame
+	for _, frame := range c.History() {
+		if frame.CapturedAt.After(t) {
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
+
+// Closest returns the retained frame whose modification time is closest to
+// t.
+func (c *ImageCache) Closest(t time.Time) (*Frame, bool) {
+	var closest *Frame
+	var best time.Duration
+	for _, frame := range c.History() {
+		d := frame.ModTime.Sub(t)
+		if d < 0 {
+			d = -d
+		}
+		if closest == nil || d < best {
+			closest, best = frame, d
+		}
+	}
+	return closest, closest != nil
+}
+
+// FrameBySeq returns the retained frame with the given sequence number.
+func (c *ImageCache) FrameBySeq(seq uint64) (*Frame, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.data != nil
+
+	if c.count == 0 {
+		return nil, false
+	}
+
+	oldest := c.ring[c.start].Seq
+	if seq < oldest || seq >= oldest+uint64(c.count) {
+		return nil, false
+	}
+	return c.ring[(c.start+int(seq-oldest))%len(c.ring)], true
 }
@@ -63,18 +63,38 @@ func TestImageCacheDataIsolation(t *testing.T) {
 
 	cache.Update(testData, modTime, fileSize)
 
+	// The producer may reuse its buffer after Update returns
+	testData[0] = 'X'
+
+	data, _, _, _ := cache.Get()
+	if data[0] == 'X' {
+		t.Error("Modifying the source buffer should not affect cached data")
+	}
+}
+
+func TestImageCacheGetSharesFrame(t *testing.T) {
+	cache := NewImageCache()
+	testData := []byte("test image data")
+
+	cache.Update(testData, time.Now(), int64(len(testData)))
+
 	data1, _, _, _ := cache.Get()
 	data2, _, _, _ := cache.Get()
 
-	if &data1[0] == &data2[0] {
-		t.Error("Get() should return independent copies of data")
+	if &data1[0] != &data2[0] {
+		t.Error("Get() should share the published frame instead of copying it")
+	}
+
+	frame1, _ := cache.Latest()
+	frame2, _ := cache.Latest()
+	if frame1 != frame2 {
+		t.Error("Latest() should return the same immutable frame to every reader")
 	}
 
-	data1[0] = 'X'
-	data3, _, _, _ := cache.Get()
+	cache.Update([]byte("new image data"), time.Now(), 14)
 
-	if data3[0] == 'X' {
-		t.Error("Modifying returned data should not affect cached data")
+	if string(data1) != "test image data" {
+		t.Error("Publishing a new frame should not modify previously returned data")
 	}
 }
 
@@ -132,3 +152,327 @@ func TestImageCacheConcurrency(t *testing.T) {
 		t.Error("Cache should have data after concurrent operations")
 	}
 }
+
+func TestImageCacheHistoryRing(t *testing.T) {
+	cache := NewImageCacheWithHistory(3, 0)
+	modTime := time.Now()
+
+	for i := 0; i < 5; i++ {
+		data := []byte{byte('a' + i)}
+		cache.Update(data, modTime.Add(time.Duration(i)*time.Second), int64(len(data)))
+	}
+
+	history := cache.History()
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 frames in history, got %d", len(history))
+	}
+
+	for i, frame := range history {
+		expectedSeq := uint64(i + 3)
+		if frame.Seq != expectedSeq {
+			t.Errorf("Frame %d: expected seq %d, got %d", i, expectedSeq, frame.Seq)
+		}
+		if frame.Data[0] != byte('a'+i+2) {
+			t.Errorf("Frame %d: unexpected data %q", i, frame.Data)
+		}
+	}
+
+	if _, ok := cache.FrameBySeq(2); ok {
+		t.Error("Evicted frame should not be retrievable")
+	}
+
+	frame, ok := cache.FrameBySeq(4)
+	if !ok {
+		t.Fatal("FrameBySeq should find retained frame")
+	}
+	if frame.Data[0] != 'd' {
+		t.Errorf("Expected frame 4 data 'd', got %q", frame.Data)
+	}
+}
+
+func TestImageCacheHistoryMemoryBudget(t *testing.T) {
+	cache := NewImageCacheWithHistory(10, 250)
+
+	for i := 0; i < 5; i++ {
+		data := bytes.Repeat([]byte{byte('a' + i)}, 100)
+		cache.Update(data, time.Now(), int64(len(data)))
+	}
+
+	history := cache.History()
+	if len(history) != 2 {
+		t.Fatalf("Expected memory budget to keep 2 frames, got %d", len(history))
+	}
+	if history[1].Seq != 5 {
+		t.Errorf("Latest frame should be retained, got seq %d", history[1].Seq)
+	}
+
+	large := bytes.Repeat([]byte("y"), 1000)
+	cache.Update(large, time.Now(), int64(len(large)))
+
+	history = cache.History()
+	if len(history) != 1 || history[0].Seq != 6 {
+		t.Error("Latest frame should be retained even when it exceeds the budget")
+	}
+}
+
+func TestImageCacheFramesSince(t *testing.T) {
+	cache := NewImageCacheWithHistory(5, 0)
+
+	cache.Update([]byte("first"), time.Now(), 5)
+	time.Sleep(time.Millisecond * 10)
+	cutoff := time.Now()
+	time.Sleep(time.Millisecond * 10)
+	cache.Update([]byte("second"), time.Now(), 6)
+	cache.Update([]byte("third"), time.Now(), 5)
+
+	frames := cache.FramesSince(cutoff)
+	if len(frames) != 2 {
+		t.Fatalf("Expected 2 frames since cutoff, got %d", len(frames))
+	}
+	if frames[0].Seq != 2 || frames[1].Seq != 3 {
+		t.Errorf("Unexpected frames since cutoff: %d, %d", frames[0].Seq, frames[1].Seq)
+	}
+}
+
+func TestImageCacheSubscribe(t *testing.T) {
+	cache := NewImageCache()
+	sub := cache.Subscribe()
+	defer sub.Close()
+
+	select {
+	case <-sub.C:
+		t.Fatal("Subscription should not signal before an update")
+	default:
+	}
+
+	cache.Update([]byte("first"), time.Now(), 5)
+	cache.Update([]byte("second"), time.Now(), 6)
+
+	select {
+	case <-sub.C:
+	case <-time.After(time.Second):
+		t.Fatal("Subscription should signal after an update")
+	}
+
+	select {
+	case <-sub.C:
+		t.Error("Notifications should be coalesced for a slow subscriber")
+	default:
+	}
+
+	frame, ok := cache.Latest()
+	if !ok || frame.Seq != 2 {
+		t.Errorf("Latest should return the second frame after notification")
+	}
+}
+
+func TestImageCacheSubscriptionClose(t *testing.T) {
+	cache := NewImageCache()
+	sub := cache.Subscribe()
+	sub.Close()
+
+	cache.Update([]byte("data"), time.Now(), 4)
+
+	select {
+	case <-sub.C:
+		t.Error("Closed subscription should not receive notifications")
+	default:
+	}
+}
+
+func TestImageCacheContentHashETag(t *testing.T) {
+	cache := NewImageCache()
+	modTime := time.Now()
+
+	// Same mod time and length but different content must not share an ETag
+	cache.Update([]byte("frame-a"), modTime, 7)
+	etag1 := cache.GetETag()
+	cache.Update([]byte("frame-b"), modTime, 7)
+	etag2 := cache.GetETag()
+
+	if etag1 == etag2 {
+		t.Errorf("Frames with different content should have different ETags, both got %s", etag1)
+	}
+
+	frame, _ := cache.Latest()
+	if frame.Hash != ContentHash([]byte("frame-b")) {
+		t.Errorf("Frame hash should match content hash, got %s", frame.Hash)
+	}
+	if frame.ETag != `"`+frame.Hash+`"` {
+		t.Errorf("ETag should be the quoted content hash, got %s", frame.ETag)
+	}
+}
+
+func TestImageCacheDeduplicatesIdenticalFrames(t *testing.T) {
+	cache := NewImageCacheWithHistory(5, 0)
+	sub := cache.Subscribe()
+	defer sub.Close()
+
+	if !cache.Update([]byte("same"), time.Now(), 4) {
+		t.Fatal("First update should store a frame")
+	}
+	<-sub.C
+
+	if cache.Update([]byte("same"), time.Now().Add(time.Second), 4) {
+		t.Error("Byte-identical update should not store a new frame")
+	}
+
+	select {
+	case <-sub.C:
+		t.Error("Byte-identical update should not notify subscribers")
+	default:
+	}
+
+	if n := len(cache.History()); n != 1 {
+		t.Errorf("Expected 1 frame in history, got %d", n)
+	}
+
+	if !cache.Update([]byte("different"), time.Now(), 9) {
+		t.Error("Changed content should store a new frame")
+	}
+	if frame, _ := cache.Latest(); frame.Seq != 2 {
+		t.Errorf("Expected seq 2 after changed content, got %d", frame.Seq)
+	}
+}
+
+func TestImageCacheMetadata(t *testing.T) {
+	cache := NewImageCache()
+	metadata := []byte(`{"faces":1}`)
+
+	cache.UpdateWithMetadata([]byte("frame"), metadata, time.Now(), 5)
+	metadata[2] = 'X'
+
+	frame, _ := cache.Latest()
+	if string(frame.Metadata) != `{"faces":1}` {
+		t.Errorf("Expected the cache to keep its own copy of the metadata, got %s", frame.Metadata)
+	}
+
+	if cache.UpdateWithMetadata([]byte("frame"), []byte(`{"faces":1}`), time.Now(), 5) {
+		t.Error("Identical frame and metadata should not store a new frame")
+	}
+	if !cache.UpdateWithMetadata([]byte("frame"), []byte(`{"faces":2}`), time.Now(), 5) {
+		t.Error("Changed metadata should store a new frame")
+	}
+	if !cache.Update([]byte("frame"), time.Now(), 5) {
+		t.Error("Dropping the metadata should store a new frame")
+	}
+	if frame, _ := cache.Latest(); frame.Metadata != nil || frame.Seq != 3 {
+		t.Errorf("Expected seq 3 without metadata, got seq %d with %s", frame.Seq, frame.Metadata)
+	}
+}
+
+func TestImageCacheSetMetadata(t *testing.T) {
+	cache := NewImageCacheWithHistory(5, 0)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		cache.Update([]byte{byte(i)}, start.Add(time.Duration(i)*time.Second), 1)
+	}
+
+	frame, ok := cache.Closest(start.Add(1200 * time.Millisecond))
+	if !ok || frame.Seq != 2 {
+		t.Fatalf("Expected frame 2 to be closest, got %+v", frame)
+	}
+
+	sub := cache.Subscribe()
+	defer sub.Close()
+
+	if !cache.SetMetadata(2, []byte(`{"faces":2}`)) {
+		t.Fatal("Expected metadata to attach to a retained frame")
+	}
+	if frame, _ := cache.FrameBySeq(2); string(frame.Metadata) != `{"faces":2}` {
+		t.Errorf("Expected frame 2 to carry the metadata, got %s", frame.Metadata)
+	}
+	select {
+	case <-sub.C:
+		t.Error("Attaching metadata to an older frame should not notify subscribers")
+	default:
+	}
+
+	cache.SetMetadata(3, []byte(`{"faces":3}`))
+	select {
+	case <-sub.C:
+	default:
+		t.Error("Attaching metadata to the latest frame should notify subscribers")
+	}
+	if frame, _ := cache.Latest(); frame.Seq != 3 || string(frame.Metadata) != `{"faces":3}` {
+		t.Errorf("Expected the latest frame to carry the metadata, got seq %d with %s", frame.Seq, frame.Metadata)
+	}
+
+	if cache.SetMetadata(9, []byte(`{}`)) {
+		t.Error("Expected no frame with seq 9")
+	}
+}
+
+func TestImageCacheStatus(t *testing.T) {
+	cache := NewImageCache()
+	cache.SetSource("/tmp/output.jpg")
+	cache.SetStaleThreshold(time.Millisecond * 50)
+
+	if status := cache.Status(); status.State != StateNoImage {
+		t.Errorf("Expected no_image for empty cache, got %s", status.State)
+	}
+
+	cache.Update([]byte("frame"), time.Now(), 5)
+
+	status := cache.Status()
+	if status.State != StateOK {
+		t.Errorf("Expected ok after update, got %s", status.State)
+	}
+	if status.Seq != 1 || status.Size != 5 || status.Source != "/tmp/output.jpg" {
+		t.Errorf("Unexpected status details: %+v", status)
+	}
+
+	time.Sleep(time.Millisecond * 80)
+	if status := cache.Status(); status.State != StateStale {
+		t.Errorf("Expected stale after threshold, got %s", status.State)
+	}
+
+	// An unchanged rewrite still shows the source is alive
+	cache.Update([]byte("frame"), time.Now(), 5)
+	if status := cache.Status(); status.State != StateOK {
+		t.Errorf("Expected ok after duplicate update, got %s", status.State)
+	}
+
+	if !cache.MarkMissing() {
+		t.Error("First MarkMissing should report a transition")
+	}
+	if cache.MarkMissing() {
+		t.Error("Repeated MarkMissing should not report a transition")
+	}
+	if status := cache.Status(); status.State != StateMissing {
+		t.Errorf("Expected missing after MarkMissing, got %s", status.State)
+	}
+	if !cache.HasData() {
+		t.Error("Missing source should not discard the cached frame")
+	}
+
+	cache.Update([]byte("new frame"), time.Now(), 9)
+	if status := cache.Status(); status.State != StateOK {
+		t.Errorf("Expected ok after source returns, got %s", status.State)
+	}
+}
+
+func TestImageCacheProducers(t *testing.T) {
+	cache := NewImageCache()
+	if status := cache.Status(); len(status.Producers) != 0 {
+		t.Errorf("Expected no producers, got %+v", status.Producers)
+	}
+
+	start := time.Now()
+	cache.SetProducer(Producer{ID: "b", Name: "pose", Connected: true, ConnectedAt: start.Add(time.Second)})
+	cache.SetProducer(Producer{ID: "a", Name: "gaze", Connected: true, ConnectedAt: start})
+	cache.SetProducer(Producer{ID: "a", Name: "gaze", Connected: true, ConnectedAt: start, Frames: 3})
+
+	producers := cache.Status().Producers
+	if len(producers) != 2 || producers[0].Name != "gaze" || producers[1].Name != "pose" {
+		t.Fatalf("Expected producers in connection order, got %+v", producers)
+	}
+	if producers[0].Frames != 3 {
+		t.Errorf("SetProducer should replace earlier state, got %+v", producers[0])
+	}
+
+	cache.RemoveProducer("a")
+	if producers := cache.Status().Producers; len(producers) != 1 || producers[0].ID != "b" {
+		t.Errorf("Expected only producer b after removal, got %+v", producers)
+	}
+}
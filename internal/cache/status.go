@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"sort"
+	"time"
+)
+
+// SourceState summarises whether the frame source is delivering images.
+type SourceState string
+
+const (
+	StateOK      SourceState = "ok"
+	StateNoImage SourceState = "no_image"
+	StateStale   SourceState = "stale"
+	StateMissing SourceState = "missing"
+)
+
+type Status struct {
+	State    SourceState
+	Source   string
+	LastSeen time.Time
+	Age      time.Duration
+	Seq      uint64
+	Size     int64
+	Rejected uint64
+
+	// Producers lists the connections feeding sources that accept several
+	// producers at once, such as a Unix socket. It is empty for file sources.
+	Producers []Producer
+}
+
+// Producer describes one connection pushing frames into the cache.
+type Producer struct {
+	ID             string
+	Name           string
+	Connected      bool
+	ConnectedAt    time.Time
+	DisconnectedAt time.Time
+	LastFrameAt    time.Time
+	Frames         uint64
+	Rejected       uint64
+}
+
+// SetSource records a description of where frames come from, such as the
+// watched file path.
+func (c *ImageCache) SetSource(source string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.source = source
+}
+
+// SetStaleThreshold sets how long the source may go without delivering a
+// frame before it is reported as stale. Zero disables staleness reporting.
+func (c *ImageCache) SetStaleThreshold(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.staleAfter = d
+}
+
+// MarkMissing records that the source has disappeared, for example because
+// the watched file was deleted. The next Update clears it. MarkMissing reports
+// whether the source was previously considered present.
+func (c *ImageCache) MarkMissing() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wasPresent := !c.missing
+	c.missing = true
+	return wasPresent
+}
+
+// SetProducer records the state of the producer with p.ID, replacing any
+// earlier state for it.
+func (c *ImageCache) SetProducer(p Producer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.producers == nil {
+		c.producers = make(map[string]Producer)
+	}
+	c.producers[p.ID] = p
+}
+
+// RemoveProducer forgets the producer with the given ID.
+func (c *ImageCache) RemoveProducer(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.producers, id)
+}
+
+// Status reports the source state along with details of the latest frame.
+// The cached frame is kept when the source goes missing or stale, so callers
+// decide whether to keep serving it.
+func (c *ImageCache) Status() Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	status := Status{
+		State:    StateOK,
+		Source:   c.source,
+		LastSeen: c.lastSeen,
+		Rejected: c.rejected.Load(),
+	}
+	if !c.lastSeen.IsZero() {
+		status.Age = time.Since(c.lastSeen)
+	}
+	if frame := c.latest.Load(); frame != nil {
+		status.Seq = frame.Seq
+		status.Size = frame.Size
+	}
+	for _, producer := range c.producers {
+		status.Producers = append(status.Producers, producer)
+	}
+	sort.Slice(status.Producers, func(i, j int) bool {
+		return status.Producers[i].ConnectedAt.Before(status.Producers[j].ConnectedAt)
+	})
+
+	switch {
+	case c.missing:
+		status.State = StateMissing
+	case c.latest.Load() == nil:
+		status.State = StateNoImage
+	case c.staleAfter > 0 && status.Age > c.staleAfter:
+		status.State = StateStale
+	}
+	return status
+}
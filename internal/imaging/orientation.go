@@ -0,0 +1,151 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// orientation is a rotation and mirroring of an image: it is mirrored
+// horizontally if flip is set and then rotated clockwise by rot degrees.
+// Every combination of quarter turns and flips reduces to one of these.
+type orientation struct {
+	flip bool
+	rot  int
+}
+
+// exifOrientations maps the EXIF orientation tag to the orientation that
+// turns the stored image upright.
+var exifOrientations = [9]orientation{
+	1: {},
+	2: {flip: true},
+	3: {rot: 180},
+	4: {flip: true, rot: 180},
+	5: {flip: true, rot: 270},
+	6: {rot: 90},
+	7: {flip: true, rot: 90},
+	8: {rot: 270},
+}
+
+// then returns the orientation of applying o followed by next.
+func (o orientation) then(next orientation) orientation {
+	rot := o.rot
+	if next.flip {
+		// Mirroring reverses the direction of the earlier rotation
+		rot = -rot
+	}
+	return orientation{flip: o.flip != next.flip, rot: ((next.rot+rot)%360 + 360) % 360}
+}
+
+func (o orientation) swapsAxes() bool {
+	return o.rot == 90 || o.rot == 270
+}
+
+// size returns the size of a src-sized image after reorienting it.
+func (o orientation) size(src image.Point) image.Point {
+	if o.swapsAxes() {
+		return image.Pt(src.Y, src.X)
+	}
+	return src
+}
+
+// apply returns src reoriented by o.
+func (o orientation) apply(src image.Image) image.Image {
+	if o == (orientation{}) {
+		return src
+	}
+
+	b := src.Bounds()
+	rgba := image.NewRGBA(image.Rectangle{Max: b.Size()})
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rectangle{Max: o.size(b.Size())})
+	for y := 0; y < h; y++ {
+		row := rgba.Pix[y*rgba.Stride:]
+		for x := 0; x < w; x++ {
+			fx := x
+			if o.flip {
+				fx = w - 1 - x
+			}
+			var dx, dy int
+			switch o.rot {
+			case 90:
+				dx, dy = h-1-y, fx
+			case 180:
+				dx, dy = w-1-fx, h-1-y
+			case 270:
+				dx, dy = y, w-1-fx
+			default:
+				dx, dy = fx, y
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:][:4], row[x*4:x*4+4])
+		}
+	}
+	return dst
+}
+
+// ExifOrientation returns the EXIF orientation tag of a JPEG, from 1 to 8,
+// or 1 when it has none.
+func ExifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// Walk the marker segments up to the start of scan looking for the
+	// EXIF APP1 segment
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			break
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of an EXIF
+// TIFF structure.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < entries; e++ {
+		entry := ifd + 2 + e*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		// Orientation is tag 0x0112, a single SHORT stored inline
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
@@ -0,0 +1,156 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// withOrientation inserts an EXIF APP1 segment carrying the orientation tag
+// after the SOI marker of a JPEG.
+func withOrientation(data []byte, orientation int, order binary.ByteOrder) []byte {
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], uint16(orientation))
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(out[4:], uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+func TestExifOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+
+	if o := ExifOrientation(buf.Bytes()); o != 1 {
+		t.Errorf("Expected 1 without EXIF, got %d", o)
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		if o := ExifOrientation(withOrientation(buf.Bytes(), 6, order)); o != 6 {
+			t.Errorf("Expected orientation 6 with %v byte order, got %d", order, o)
+		}
+	}
+	if o := ExifOrientation([]byte("not a jpeg")); o != 1 {
+		t.Errorf("Expected 1 for invalid data, got %d", o)
+	}
+}
+
+// marked returns a 3x2 image with a distinct grey level per pixel, so the
+// position of every pixel can be checked after reorienting it.
+func marked() *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 40)
+	}
+	return img
+}
+
+func pixels(img image.Image) [][]uint8 {
+	b := img.Bounds()
+	var rows [][]uint8
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		var row []uint8
+		for x := b.Min.X; x < b.Max.X; x++ {
+			row = append(row, color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestOrientationApply(t *testing.T) {
+	// The source is
+	//   0  40  80
+	//  120 160 200
+	tests := []struct {
+		name      string
+		transform Transform
+		expected  [][]uint8
+	}{
+		{"rotate 90", Transform{Rotate: 90}, [][]uint8{{120, 0}, {160, 40}, {200, 80}}},
+		{"rotate 180", Transform{Rotate: 180}, [][]uint8{{200, 160, 120}, {80, 40, 0}}},
+		{"rotate 270", Transform{Rotate: 270}, [][]uint8{{80, 200}, {40, 160}, {0, 120}}},
+		{"flip h", Transform{FlipH: true}, [][]uint8{{80, 40, 0}, {200, 160, 120}}},
+		{"flip v", Transform{FlipV: true}, [][]uint8{{120, 160, 200}, {0, 40, 80}}},
+		{"rotate 90 then flip h", Transform{Rotate: 90, FlipH: true}, [][]uint8{{0, 120}, {40, 160}, {80, 200}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pixels(tt.transform.orientation(1).apply(marked()))
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, got)
+			}
+			for y := range got {
+				if !bytes.Equal(got[y], tt.expected[y]) {
+					t.Fatalf("Expected %v, got %v", tt.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestOrientationThen(t *testing.T) {
+	// Composing orientations must match applying them one after another
+	all := exifOrientations[1:]
+	for _, first := range all {
+		for _, second := range all {
+			sequential := pixels(second.apply(first.apply(marked())))
+			combined := pixels(first.then(second).apply(marked()))
+			for y := range sequential {
+				if y >= len(combined) || !bytes.Equal(sequential[y], combined[y]) {
+					t.Fatalf("%+v then %+v: expected %v, got %v", first, second, sequential, combined)
+				}
+			}
+		}
+	}
+}
+
+func TestTransformApplyHonoursExifOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 64, 32)), nil)
+	// Orientation 6 means the stored 64x32 image is shown as 32x64
+	rotated := withOrientation(buf.Bytes(), 6, binary.BigEndian)
+
+	out, err := Transform{Quality: 90}.Apply(rotated)
+	if err != nil {
+		t.Fatalf("Failed to apply transform: %v", err)
+	}
+	if size, _ := FrameSize(out); size != image.Pt(32, 64) {
+		t.Errorf("Expected upright 32x64 output, got %v", size)
+	}
+	if o := ExifOrientation(out); o != 1 {
+		t.Errorf("Expected the orientation tag to be stripped, got %d", o)
+	}
+
+	// Rotating by 90 on top of the EXIF orientation gives 64x32 again
+	out, err = Transform{Rotate: 90}.Apply(rotated)
+	if err != nil {
+		t.Fatalf("Failed to apply transform: %v", err)
+	}
+	if size, _ := FrameSize(out); size != image.Pt(64, 32) {
+		t.Errorf("Expected 64x32 output, got %v", size)
+	}
+
+	if err := (Transform{Crop: Rect{W: 32, H: 64}}).Check(rotated); err != nil {
+		t.Errorf("Expected a crop of the upright frame to fit, got %v", err)
+	}
+	if err := (Transform{Crop: Rect{W: 64, H: 32}}).Check(rotated); err == nil {
+		t.Error("Expected a crop of the stored frame's size not to fit the upright frame")
+	}
+}
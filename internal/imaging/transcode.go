@@ -0,0 +1,136 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/webp"
+)
+
+// Format is an image container format recognised from its leading bytes.
+type Format string
+
+const (
+	FormatUnknown Format = ""
+	FormatJPEG    Format = "jpeg"
+	FormatPNG     Format = "png"
+	FormatGIF     Format = "gif"
+	FormatBMP     Format = "bmp"
+	FormatTIFF    Format = "tiff"
+	FormatWebP    Format = "webp"
+)
+
+// DefaultTranscodeQuality is the JPEG quality used for frames that arrive
+// in another format.
+const DefaultTranscodeQuality = 90
+
+// imageExtensions are the file extensions of the formats frames may arrive
+// in.
+var imageExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+	".bmp": true, ".tif": true, ".tiff": true, ".webp": true,
+}
+
+// HasImageExtension reports whether path has the extension of a format
+// frames may arrive in, ignoring case.
+func HasImageExtension(path string) bool {
+	return imageExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// DetectFormat sniffs the image format from the start of data.
+func DetectFormat(data []byte) Format {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		return FormatJPEG
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return FormatGIF
+	case bytes.HasPrefix(data, []byte("BM")):
+		return FormatBMP
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return FormatTIFF
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return FormatWebP
+	default:
+		return FormatUnknown
+	}
+}
+
+func decode(data []byte, format Format) (image.Image, error) {
+	r := bytes.NewReader(data)
+	switch format {
+	case FormatPNG:
+		return png.Decode(r)
+	case FormatGIF:
+		// Only the first frame of an animation is used
+		return gif.Decode(r)
+	case FormatBMP:
+		return bmp.Decode(r)
+	case FormatTIFF:
+		return tiff.Decode(r)
+	case FormatWebP:
+		return webp.Decode(r)
+	default:
+		return nil, fmt.Errorf("cannot decode %q images", format)
+	}
+}
+
+// ToJPEG transcodes PNG, GIF, BMP, TIFF and WebP data to a JPEG at the given
+// quality. JPEG data, and data in any unrecognised format, is returned
+// untouched so that JPEG validation can judge it. Transparent pixels end up
+// black, as JPEG has no alpha channel.
+func ToJPEG(data []byte, quality int) ([]byte, Format, error) {
+	format := DetectFormat(data)
+	if format == FormatJPEG || format == FormatUnknown {
+		return data, format, nil
+	}
+
+	img, err := decode(data, format)
+	if err != nil {
+		// Also the result of reading a file that is still being written
+		return nil, format, fmt.Errorf("failed to decode %s: %w", format, err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, format, fmt.Errorf("failed to encode %s as JPEG: %w", format, err)
+	}
+	return buf.Bytes(), format, nil
+}
+
+// Input describes how frames from a source are converted and checked
+// before they are cached.
+type Input struct {
+	Validation       ValidationLevel
+	TranscodeQuality int
+}
+
+// DefaultInput validates JPEG markers and transcodes other formats at
+// DefaultTranscodeQuality.
+var DefaultInput = Input{
+	Validation:       ValidateMarkers,
+	TranscodeQuality: DefaultTranscodeQuality,
+}
+
+// Prepare returns data as a JPEG ready to cache. Non-JPEG images are
+// transcoded; JPEG data is validated at the configured level and passed
+// through unchanged.
+func (in Input) Prepare(data []byte) ([]byte, error) {
+	out, format, err := ToJPEG(data, in.TranscodeQuality)
+	if err != nil {
+		return nil, err
+	}
+	if format != FormatJPEG && format != FormatUnknown {
+		return out, nil
+	}
+	return out, ValidateJPEG(out, in.Validation)
+}
@@ -0,0 +1,126 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 24, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 24; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 10), uint8(y * 15), 128, 255})
+		}
+	}
+	return img
+}
+
+func encodeAs(t *testing.T, format Format) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case FormatJPEG:
+		err = jpeg.Encode(&buf, testImage(), nil)
+	case FormatPNG:
+		err = png.Encode(&buf, testImage())
+	case FormatGIF:
+		err = gif.Encode(&buf, testImage(), nil)
+	case FormatBMP:
+		err = bmp.Encode(&buf, testImage())
+	case FormatTIFF:
+		err = tiff.Encode(&buf, testImage(), nil)
+	case FormatWebP:
+		// x/image can decode WebP but not encode it
+		data, err := os.ReadFile("testdata/gopher.webp")
+		if err != nil {
+			t.Fatalf("Failed to read WebP fixture: %v", err)
+		}
+		return data
+	}
+	if err != nil {
+		t.Fatalf("Failed to encode %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+func TestHasImageExtension(t *testing.T) {
+	for path, expected := range map[string]bool{
+		"/tmp/frames/frame_000001.jpg": true,
+		"frame.JPEG":                   true,
+		"frame.webp":                   true,
+		"output.json":                  false,
+		"config.ini":                   false,
+		"frame":                        false,
+	} {
+		if got := HasImageExtension(path); got != expected {
+			t.Errorf("%s: expected %v, got %v", path, expected, got)
+		}
+	}
+}
+
+func TestToJPEG(t *testing.T) {
+	for _, format := range []Format{FormatPNG, FormatGIF, FormatBMP, FormatTIFF, FormatWebP} {
+		t.Run(string(format), func(t *testing.T) {
+			data := encodeAs(t, format)
+			if detected := DetectFormat(data); detected != format {
+				t.Fatalf("Expected %s to be detected, got %q", format, detected)
+			}
+
+			out, detected, err := ToJPEG(data, 80)
+			if err != nil {
+				t.Fatalf("Failed to transcode: %v", err)
+			}
+			if detected != format {
+				t.Errorf("Expected source format %s, got %q", format, detected)
+			}
+
+			img, err := jpeg.Decode(bytes.NewReader(out))
+			if err != nil {
+				t.Fatalf("Transcoded frame is not a valid JPEG: %v", err)
+			}
+			original, _ := decode(data, format)
+			if img.Bounds() != original.Bounds() {
+				t.Errorf("Expected size %v, got %v", original.Bounds(), img.Bounds())
+			}
+		})
+	}
+}
+
+func TestToJPEGPassesThroughJPEG(t *testing.T) {
+	data := encodeAs(t, FormatJPEG)
+	out, format, err := ToJPEG(data, 50)
+	if err != nil || format != FormatJPEG {
+		t.Fatalf("Unexpected result for JPEG input: %q %v", format, err)
+	}
+	if &out[0] != &data[0] {
+		t.Error("JPEG input should be returned untouched, not re-encoded")
+	}
+}
+
+func TestInputPrepare(t *testing.T) {
+	input := DefaultInput
+
+	if _, err := input.Prepare(encodeAs(t, FormatPNG)); err != nil {
+		t.Errorf("PNG should be transcoded, got %v", err)
+	}
+
+	png := encodeAs(t, FormatPNG)
+	if _, err := input.Prepare(png[:len(png)/2]); err == nil {
+		t.Error("Truncated PNG should be rejected")
+	}
+
+	if _, err := input.Prepare([]byte("not an image")); !errors.Is(err, ErrNotJPEG) {
+		t.Errorf("Unknown data should fail JPEG validation, got %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+// Limits on transformed output, so a request cannot make the server
+// allocate an arbitrarily large image.
+const (
+	MaxOutputDimension = 4096
+	MaxScale           = 4.0
+)
+
+const defaultOutputQuality = 85
+
+var ErrInvalidTransform = errors.New("invalid transform")
+
+// Transform describes how a frame is altered before it is served. Frames are
+// first turned upright according to their EXIF orientation, then rotated and
+// flipped, cropped and finally resized. The zero value leaves frames
+// untouched.
+type Transform struct {
+	// Width and Height resize the frame. With only one of them set the
+	// other follows the aspect ratio; with both the frame is fitted inside
+	// the box, keeping its aspect ratio.
+	Width  int
+	Height int
+	// Scale resizes the frame by a factor. It cannot be combined with
+	// Width or Height.
+	Scale float64
+	// Quality is the JPEG quality the frame is re-encoded at, from 1 to
+	// 100. Zero uses the default output quality.
+	Quality int
+	// Crop cuts a region out of the frame before it is resized. The region
+	// is in the coordinates of the rotated and flipped frame.
+	Crop Rect
+	// Rotate turns the frame clockwise by 0, 90, 180 or 270 degrees.
+	Rotate int
+	// FlipH and FlipV mirror the frame horizontally and vertically after
+	// it has been rotated.
+	FlipH, FlipV bool
+}
+
+// Rect is a crop rectangle. With Normalized set the coordinates are
+// fractions of the frame's width and height, otherwise they are pixels.
+type Rect struct {
+	X, Y, W, H float64
+	Normalized bool
+}
+
+func (r Rect) IsZero() bool {
+	return r == Rect{}
+}
+
+// Pixels returns the rectangle in pixels for a frame of the given size.
+func (r Rect) Pixels(size image.Point) image.Rectangle {
+	if !r.Normalized {
+		return image.Rect(int(r.X), int(r.Y), int(r.X+r.W), int(r.Y+r.H))
+	}
+	w, h := float64(size.X), float64(size.Y)
+	rect := image.Rect(int(r.X*w+0.5), int(r.Y*h+0.5), int((r.X+r.W)*w+0.5), int((r.Y+r.H)*h+0.5))
+	// Keep tiny normalized regions at least a pixel wide
+	rect.Max.X = max(rect.Max.X, rect.Min.X+1)
+	rect.Max.Y = max(rect.Max.Y, rect.Min.Y+1)
+	return rect
+}
+
+func (r Rect) String() string {
+	g := func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
+	return g(r.X) + "," + g(r.Y) + "," + g(r.W) + "," + g(r.H)
+}
+
+func (t Transform) IsZero() bool {
+	return t == Transform{}
+}
+
+// Validate reports whether the transform's parameters are usable.
+func (t Transform) Validate() error {
+	switch {
+	case t.Width < 0 || t.Height < 0 || t.Scale < 0:
+		return fmt.Errorf("%w: sizes must be positive", ErrInvalidTransform)
+	case t.Quality < 0 || t.Quality > 100:
+		return fmt.Errorf("%w: quality must be between 1 and 100", ErrInvalidTransform)
+	case t.Rotate != 0 && t.Rotate != 90 && t.Rotate != 180 && t.Rotate != 270:
+		return fmt.Errorf("%w: rotate must be 90, 180 or 270", ErrInvalidTransform)
+	case t.Width > MaxOutputDimension || t.Height > MaxOutputDimension:
+		return fmt.Errorf("%w: width and height are limited to %d", ErrInvalidTransform, MaxOutputDimension)
+	case t.Scale > MaxScale:
+		return fmt.Errorf("%w: scale is limited to %g", ErrInvalidTransform, MaxScale)
+	case t.Scale != 0 && (t.Width != 0 || t.Height != 0):
+		return fmt.Errorf("%w: scale cannot be combined with width or height", ErrInvalidTransform)
+	}
+	if c := t.Crop; !c.IsZero() {
+		switch {
+		case c.X < 0 || c.Y < 0 || c.W <= 0 || c.H <= 0:
+			return fmt.Errorf("%w: crop %s needs a positive width and height and no negative offsets", ErrInvalidTransform, c)
+		case c.Normalized && (c.X+c.W > 1 || c.Y+c.H > 1):
+			return fmt.Errorf("%w: normalized crop %s extends past the frame", ErrInvalidTransform, c)
+		}
+	}
+	return nil
+}
+
+// orientation returns the combined reorientation for a frame with the given
+// EXIF orientation tag.
+func (t Transform) orientation(exif int) orientation {
+	if exif < 1 || exif > 8 {
+		exif = 1
+	}
+	o := exifOrientations[exif].then(orientation{rot: t.Rotate})
+	if t.FlipH {
+		o = o.then(orientation{flip: true})
+	}
+	if t.FlipV {
+		o = o.then(orientation{flip: true, rot: 180})
+	}
+	return o
+}
+
+// Check reports whether the transform can be applied to the JPEG in data,
+// reading only its headers.
+func (t Transform) Check(data []byte) error {
+	size, err := FrameSize(data)
+	if err != nil {
+		return err
+	}
+	return t.Fits(t.orientation(ExifOrientation(data)).size(size))
+}
+
+// Fits reports whether the transform can be applied to an upright, rotated
+// and flipped frame of the given size, which fails when a pixel crop
+// extends past the frame.
+func (t Transform) Fits(size image.Point) error {
+	if t.Crop.IsZero() {
+		return nil
+	}
+	if !t.Crop.Pixels(size).In(image.Rectangle{Max: size}) {
+		return fmt.Errorf("%w: crop %s extends past the %dx%d frame", ErrInvalidTransform, t.Crop, size.X, size.Y)
+	}
+	return nil
+}
+
+// Key identifies the transform, so identical requests can share results.
+func (t Transform) Key() string {
+	key := "w" + strconv.Itoa(t.Width) + "h" + strconv.Itoa(t.Height) +
+		"s" + strconv.FormatFloat(t.Scale, 'g', -1, 64) + "q" + strconv.Itoa(t.Quality)
+	if !t.Crop.IsZero() {
+		// Not Crop.String: keys end up in ETags, where a comma would split
+		// the tag in If-None-Match
+		g := func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
+		key += "c" + g(t.Crop.X) + "_" + g(t.Crop.Y) + "_" + g(t.Crop.W) + "_" + g(t.Crop.H)
+		if t.Crop.Normalized {
+			key += "n"
+		}
+	}
+	if t.Rotate != 0 {
+		key += "r" + strconv.Itoa(t.Rotate)
+	}
+	if t.FlipH {
+		key += "fh"
+	}
+	if t.FlipV {
+		key += "fv"
+	}
+	return key
+}
+
+// outputSize returns the size of a src-sized image after resizing.
+func (t Transform) outputSize(src image.Point) image.Point {
+	if src.X == 0 || src.Y == 0 {
+		return src
+	}
+
+	w, h := float64(src.X), float64(src.Y)
+	switch {
+	case t.Scale != 0:
+		w, h = w*t.Scale, h*t.Scale
+	case t.Width != 0 && t.Height != 0:
+		fit := min(float64(t.Width)/w, float64(t.Height)/h)
+		w, h = w*fit, h*fit
+	case t.Width != 0:
+		w, h = float64(t.Width), h*float64(t.Width)/w
+	case t.Height != 0:
+		w, h = w*float64(t.Height)/h, float64(t.Height)
+	}
+
+	size := image.Pt(int(w+0.5), int(h+0.5))
+	size.X = min(max(size.X, 1), MaxOutputDimension)
+	size.Y = min(max(size.Y, 1), MaxOutputDimension)
+	return size
+}
+
+// Apply decodes a JPEG, transforms it and encodes the result as a JPEG.
+// Frames are always re-encoded, so a transform setting only Quality changes
+// nothing but the compression. The output is upright and carries no EXIF
+// orientation.
+func (t Transform) Apply(data []byte) ([]byte, error) {
+	src, err := decodeJPEG(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// The encoder writes no EXIF, so the orientation tag is dropped along
+	// with the rest of the metadata once the pixels are upright
+	img := t.orientation(ExifOrientation(data)).apply(src)
+	if !t.Crop.IsZero() {
+		size := img.Bounds().Size()
+		if err := t.Fits(size); err != nil {
+			return nil, err
+		}
+		// The decoder's image types and RGBA share their pixels with
+		// sub-images
+		sub, ok := img.(interface {
+			SubImage(image.Rectangle) image.Image
+		})
+		if !ok {
+			return nil, fmt.Errorf("cannot crop %T frames", img)
+		}
+		img = sub.SubImage(t.Crop.Pixels(size).Add(img.Bounds().Min))
+	}
+
+	size := t.outputSize(img.Bounds().Size())
+	if size != img.Bounds().Size() {
+		// BiLinear widens its kernel when shrinking, which avoids the
+		// aliasing of cheaper scalers on large reductions
+		dst := image.NewRGBA(image.Rectangle{Max: size})
+		draw.BiLinear.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+		img = dst
+	}
+
+	quality := t.Quality
+	if quality == 0 {
+		quality = defaultOutputQuality
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, fmt.Errorf("failed to encode frame: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeUpright decodes a JPEG and turns it upright according to its EXIF
+// orientation.
+func DecodeUpright(data []byte) (image.Image, error) {
+	src, err := decodeJPEG(data)
+	if err != nil {
+		return nil, err
+	}
+	return Transform{}.orientation(ExifOrientation(data)).apply(src), nil
+}
+
+func decodeJPEG(data []byte) (image.Image, error) {
+	src, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode frame: %w", err)
+	}
+	return src, nil
+}
+
+// FrameSize returns the dimensions of a JPEG without decoding its pixels.
+func FrameSize(data []byte) (image.Point, error) {
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return image.Point{}, err
+	}
+	return image.Pt(config.Width, config.Height), nil
+}
@@ -0,0 +1,150 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+func TestTransformOutputSize(t *testing.T) {
+	src := image.Pt(1920, 1080)
+	tests := []struct {
+		name      string
+		transform Transform
+		expected  image.Point
+	}{
+		{"none", Transform{}, src},
+		{"width", Transform{Width: 640}, image.Pt(640, 360)},
+		{"height", Transform{Height: 270}, image.Pt(480, 270)},
+		{"fit wide box", Transform{Width: 1000, Height: 270}, image.Pt(480, 270)},
+		{"fit tall box", Transform{Width: 320, Height: 1000}, image.Pt(320, 180)},
+		{"scale", Transform{Scale: 0.25}, image.Pt(480, 270)},
+		{"tiny", Transform{Width: 1}, image.Pt(1, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if size := tt.transform.outputSize(src); size != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, size)
+			}
+		})
+	}
+}
+
+func TestTransformValidate(t *testing.T) {
+	invalid := []Transform{
+		{Width: -1},
+		{Width: MaxOutputDimension + 1},
+		{Scale: MaxScale + 1},
+		{Scale: 0.5, Width: 100},
+		{Quality: -1},
+		{Quality: 101},
+		{Crop: Rect{X: 0, Y: 0, W: 0, H: 10}},
+		{Crop: Rect{X: -1, Y: 0, W: 10, H: 10}},
+		{Crop: Rect{X: 0.5, Y: 0, W: 0.6, H: 0.5, Normalized: true}},
+		{Rotate: 45},
+		{Rotate: -90},
+	}
+	for _, transform := range invalid {
+		if err := transform.Validate(); !errors.Is(err, ErrInvalidTransform) {
+			t.Errorf("Expected %+v to be invalid, got %v", transform, err)
+		}
+	}
+	if err := (Transform{Width: 320, Height: 240}).Validate(); err != nil {
+		t.Errorf("Expected valid transform, got %v", err)
+	}
+}
+
+func TestTransformApply(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 64, 48)), nil)
+
+	out, err := Transform{Scale: 0.5}.Apply(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to apply transform: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("Output is not a valid JPEG: %v", err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(32, 24) {
+		t.Errorf("Expected 32x24 output, got %v", size)
+	}
+
+	if _, err := (Transform{Scale: 0.5}).Apply([]byte("not a jpeg")); err == nil {
+		t.Error("Expected an error for undecodable input")
+	}
+}
+
+func TestTransformApplyQuality(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95})
+
+	high, err := Transform{Quality: 90}.Apply(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to apply transform: %v", err)
+	}
+	low, err := Transform{Quality: 10}.Apply(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to apply transform: %v", err)
+	}
+	if len(low) >= len(high) {
+		t.Errorf("Expected quality 10 to be smaller than quality 90, got %d and %d bytes", len(low), len(high))
+	}
+	if decoded, err := jpeg.Decode(bytes.NewReader(low)); err != nil || decoded.Bounds() != img.Bounds() {
+		t.Errorf("Expected a 64x48 JPEG, got %v (%v)", decoded, err)
+	}
+}
+
+func TestTransformCrop(t *testing.T) {
+	frame := image.Pt(1920, 1080)
+	tests := []struct {
+		name     string
+		crop     Rect
+		expected image.Rectangle
+	}{
+		{"pixels", Rect{X: 100, Y: 50, W: 640, H: 360}, image.Rect(100, 50, 740, 410)},
+		{"normalized", Rect{X: 0.25, Y: 0.5, W: 0.5, H: 0.5, Normalized: true}, image.Rect(480, 540, 1440, 1080)},
+		{"tiny normalized", Rect{X: 0.5, Y: 0.5, W: 0.0001, H: 0.0001, Normalized: true}, image.Rect(960, 540, 961, 541)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rect := tt.crop.Pixels(frame); rect != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, rect)
+			}
+			if err := (Transform{Crop: tt.crop}).Fits(frame); err != nil {
+				t.Errorf("Expected crop to fit, got %v", err)
+			}
+		})
+	}
+
+	outside := Transform{Crop: Rect{X: 1800, Y: 0, W: 200, H: 100}}
+	if err := outside.Fits(frame); !errors.Is(err, ErrInvalidTransform) {
+		t.Errorf("Expected crop past the frame edge to be invalid, got %v", err)
+	}
+}
+
+func TestTransformApplyCropAndResize(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 64, 48)), nil)
+
+	out, err := Transform{Crop: Rect{X: 16, Y: 8, W: 32, H: 32}, Width: 16}.Apply(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to apply transform: %v", err)
+	}
+	size, err := FrameSize(out)
+	if err != nil || size != image.Pt(16, 16) {
+		t.Errorf("Expected 16x16 output, got %v (%v)", size, err)
+	}
+
+	if _, err := (Transform{Crop: Rect{X: 0, Y: 0, W: 65, H: 48}}).Apply(buf.Bytes()); !errors.Is(err, ErrInvalidTransform) {
+		t.Errorf("Expected an invalid transform error for a crop past the frame, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/jpeg"
+)
+
+// ValidationLevel controls how thoroughly incoming JPEG data is checked
+// before it is cached.
+type ValidationLevel string
+
+const (
+	// ValidateNone accepts any data.
+	ValidateNone ValidationLevel = "none"
+	// ValidateMarkers checks for the SOI and EOI markers, which catches
+	// files that are still being written.
+	ValidateMarkers ValidationLevel = "markers"
+	// ValidateDecode additionally decodes the whole image.
+	ValidateDecode ValidationLevel = "decode"
+)
+
+var (
+	ErrNotJPEG    = errors.New("not a JPEG: missing SOI marker")
+	ErrIncomplete = errors.New("incomplete JPEG: missing EOI marker")
+)
+
+var (
+	soiMarker = []byte{0xFF, 0xD8}
+	eoiMarker = []byte{0xFF, 0xD9}
+)
+
+func ParseValidationLevel(s string) (ValidationLevel, error) {
+	switch level := ValidationLevel(s); level {
+	case ValidateNone, ValidateMarkers, ValidateDecode:
+		return level, nil
+	default:
+		return "", fmt.Errorf("unknown validation level %q (want none, markers or decode)", s)
+	}
+}
+
+// ValidateJPEG checks data at the given level and returns ErrNotJPEG,
+// ErrIncomplete or a decode error if it is not a complete JPEG.
+func ValidateJPEG(data []byte, level ValidationLevel) error {
+	if level == ValidateNone {
+		return nil
+	}
+
+	if !bytes.HasPrefix(data, soiMarker) {
+		return ErrNotJPEG
+	}
+	if !bytes.HasSuffix(data, eoiMarker) {
+		return ErrIncomplete
+	}
+
+	if level == ValidateDecode {
+		if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("corrupt JPEG: %w", err)
+		}
+	}
+	return nil
+}
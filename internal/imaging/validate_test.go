@@ -0,0 +1,62 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+func encodeTestJPEG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 16, 16)), nil); err != nil {
+		t.Fatalf("Failed to encode test JPEG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestValidateJPEGMarkers(t *testing.T) {
+	valid := []byte{0xFF, 0xD8, 'x', 0xFF, 0xD9}
+
+	if err := ValidateJPEG(valid, ValidateMarkers); err != nil {
+		t.Errorf("Expected valid markers to pass, got %v", err)
+	}
+	if err := ValidateJPEG([]byte("PNG data"), ValidateMarkers); !errors.Is(err, ErrNotJPEG) {
+		t.Errorf("Expected ErrNotJPEG, got %v", err)
+	}
+	if err := ValidateJPEG(valid[:3], ValidateMarkers); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("Expected ErrIncomplete for truncated data, got %v", err)
+	}
+	if err := ValidateJPEG([]byte("anything"), ValidateNone); err != nil {
+		t.Errorf("ValidateNone should accept any data, got %v", err)
+	}
+}
+
+func TestValidateJPEGDecode(t *testing.T) {
+	data := encodeTestJPEG(t)
+
+	if err := ValidateJPEG(data, ValidateDecode); err != nil {
+		t.Errorf("Expected encoded JPEG to decode, got %v", err)
+	}
+
+	// Keep the markers but corrupt the middle of the image
+	corrupt := append([]byte{}, data[:len(data)/2]...)
+	corrupt = append(corrupt, 0xFF, 0xD9)
+	if err := ValidateJPEG(corrupt, ValidateMarkers); err != nil {
+		t.Errorf("Marker validation should not decode, got %v", err)
+	}
+	if err := ValidateJPEG(corrupt, ValidateDecode); err == nil {
+		t.Error("Decode validation should reject a torn image")
+	}
+}
+
+func TestParseValidationLevel(t *testing.T) {
+	if level, err := ParseValidationLevel("decode"); err != nil || level != ValidateDecode {
+		t.Errorf("ParseValidationLevel(decode) = %q, %v", level, err)
+	}
+	if _, err := ParseValidationLevel("full"); err == nil {
+		t.Error("ParseValidationLevel should reject unknown levels")
+	}
+}
@@ -0,0 +1,94 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	"golang.org/x/image/draw"
+)
+
+// YUV420 decodes a JPEG into planar 4:2:0 YCbCr (I420): the full-size Y
+// plane followed by the Cb and Cr planes at half the width and height,
+// rounded up. With size set the frame is scaled to exactly that size,
+// otherwise it keeps its own. It returns the planes and the frame size.
+func YUV420(data []byte, size image.Point) ([]byte, image.Point, error) {
+	src, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, image.Point{}, fmt.Errorf("failed to decode frame: %w", err)
+	}
+	if size == (image.Point{}) {
+		size = src.Bounds().Size()
+	}
+
+	// Most JPEGs are already 4:2:0 and copy straight across
+	if ycc, ok := src.(*image.YCbCr); ok && ycc.SubsampleRatio == image.YCbCrSubsampleRatio420 && ycc.Bounds().Size() == size {
+		return copyYCbCr420(ycc), size, nil
+	}
+
+	rgba := image.NewRGBA(image.Rectangle{Max: size})
+	if src.Bounds().Size() == size {
+		draw.Draw(rgba, rgba.Bounds(), src, src.Bounds().Min, draw.Src)
+	} else {
+		draw.BiLinear.Scale(rgba, rgba.Bounds(), src, src.Bounds(), draw.Src, nil)
+	}
+	return rgbaToYCbCr420(rgba), size, nil
+}
+
+func planeSizes(size image.Point) (luma, chroma image.Point) {
+	return size, image.Pt((size.X+1)/2, (size.Y+1)/2)
+}
+
+func copyYCbCr420(img *image.YCbCr) []byte {
+	luma, chroma := planeSizes(img.Bounds().Size())
+	out := make([]byte, 0, luma.X*luma.Y+2*chroma.X*chroma.Y)
+
+	origin := img.Bounds().Min
+	for y := 0; y < luma.Y; y++ {
+		off := img.YOffset(origin.X, origin.Y+y)
+		out = append(out, img.Y[off:off+luma.X]...)
+	}
+	for _, plane := range [][]byte{img.Cb, img.Cr} {
+		for y := 0; y < chroma.Y; y++ {
+			off := img.COffset(origin.X, origin.Y+2*y)
+			out = append(out, plane[off:off+chroma.X]...)
+		}
+	}
+	return out
+}
+
+// rgbaToYCbCr420 converts with the JPEG (full range) coefficients, averaging
+// each 2x2 block for the chroma planes.
+func rgbaToYCbCr420(img *image.RGBA) []byte {
+	luma, chroma := planeSizes(img.Bounds().Size())
+	out := make([]byte, luma.X*luma.Y+2*chroma.X*chroma.Y)
+	yPlane := out[:luma.X*luma.Y]
+	cbPlane := out[len(yPlane) : len(yPlane)+chroma.X*chroma.Y]
+	crPlane := out[len(yPlane)+len(cbPlane):]
+
+	for y := 0; y < luma.Y; y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < luma.X; x++ {
+			p := row[x*4:]
+			yPlane[y*luma.X+x], _, _ = color.RGBToYCbCr(p[0], p[1], p[2])
+		}
+	}
+
+	for cy := 0; cy < chroma.Y; cy++ {
+		for cx := 0; cx < chroma.X; cx++ {
+			var r, g, b, n int
+			for y := 2 * cy; y < min(2*cy+2, luma.Y); y++ {
+				for x := 2 * cx; x < min(2*cx+2, luma.X); x++ {
+					p := img.Pix[y*img.Stride+x*4:]
+					r, g, b, n = r+int(p[0]), g+int(p[1]), b+int(p[2]), n+1
+				}
+			}
+			_, cb, cr := color.RGBToYCbCr(uint8(r/n), uint8(g/n), uint8(b/n))
+			cbPlane[cy*chroma.X+cx] = cb
+			crPlane[cy*chroma.X+cx] = cr
+		}
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestYUV420(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 33, 17))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100})
+
+	tests := []struct {
+		name     string
+		size     image.Point
+		expected image.Point
+	}{
+		{"native odd size", image.Point{}, image.Pt(33, 17)},
+		{"scaled", image.Pt(16, 8), image.Pt(16, 8)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			planes, size, err := YUV420(buf.Bytes(), tt.size)
+			if err != nil {
+				t.Fatalf("Failed to convert frame: %v", err)
+			}
+			if size != tt.expected {
+				t.Errorf("Expected size %v, got %v", tt.expected, size)
+			}
+			chroma := ((size.X + 1) / 2) * ((size.Y + 1) / 2)
+			if len(planes) != size.X*size.Y+2*chroma {
+				t.Fatalf("Expected %d bytes, got %d", size.X*size.Y+2*chroma, len(planes))
+			}
+
+			// A uniform grey has its luma level and neutral chroma everywhere
+			luma, _, _ := color.RGBToYCbCr(200, 200, 200)
+			for i, v := range planes {
+				want := luma
+				if i >= size.X*size.Y {
+					want = 128
+				}
+				if diff := int(v) - int(want); diff < -3 || diff > 3 {
+					t.Fatalf("Byte %d: expected about %d, got %d", i, want, v)
+				}
+			}
+		})
+	}
+
+	if _, _, err := YUV420([]byte("not a jpeg"), image.Point{}); err == nil {
+		t.Error("Expected an error for undecodable input")
+	}
+}
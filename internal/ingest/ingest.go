@@ -0,0 +1,78 @@
+// Package ingest provides frame sources that push images into an
+// ImageCache directly instead of through a watched file.
+package ingest
+
+import (
+	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+	"github.com/bs-frame-monitor/internal/imaging"
+)
+
+type config struct {
+	input        imaging.Input
+	maxFrameSize int
+	pollInterval time.Duration
+}
+
+const defaultPollInterval = 5 * time.Millisecond
+
+type Option func(*config)
+
+// WithValidation sets how each frame is checked before it is cached.
+// Frames that fail are counted as rejected and the last good frame is kept.
+func WithValidation(level imaging.ValidationLevel) Option {
+	return func(c *config) {
+		c.input.Validation = level
+	}
+}
+
+// WithTranscodeQuality sets the JPEG quality used for frames that arrive as
+// PNG, GIF, BMP, TIFF or WebP.
+func WithTranscodeQuality(quality int) Option {
+	return func(c *config) {
+		c.input.TranscodeQuality = quality
+	}
+}
+
+// WithMaxFrameSize bounds the size of a single frame in bytes.
+func WithMaxFrameSize(n int) Option {
+	return func(c *config) {
+		c.maxFrameSize = n
+	}
+}
+
+// WithPollInterval sets how often sources without change notifications,
+// such as a shared-memory ring, check for a new frame.
+func WithPollInterval(d time.Duration) Option {
+	return func(c *config) {
+		if d > 0 {
+			c.pollInterval = d
+		}
+	}
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{
+		input:        imaging.DefaultInput,
+		maxFrameSize: DefaultMaxFrameSize,
+		pollInterval: defaultPollInterval,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// Publish converts data to a JPEG if needed, validates it and stores it in
+// the cache as a frame with the given modification time. Frames that cannot
+// be used are counted as rejected.
+func Publish(c *cache.ImageCache, input imaging.Input, data []byte, modTime time.Time) error {
+	frame, err := input.Prepare(data)
+	if err != nil {
+		c.RecordRejected()
+		return err
+	}
+	c.Update(frame, modTime, int64(len(frame)))
+	return nil
+}
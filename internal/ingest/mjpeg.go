@@ -0,0 +1,210 @@
+package ingest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxFrameSize bounds a single frame so a corrupt stream without an
+// EOI marker cannot grow a frame buffer without limit.
+const DefaultMaxFrameSize = 16 * 1024 * 1024
+
+// Errors for frames that are skipped. The reader resynchronises on the next
+// SOI marker, so Next can be called again after either of them.
+var (
+	ErrFrameTooLarge = errors.New("frame exceeds maximum size")
+	ErrCorruptStream = errors.New("corrupt JPEG stream")
+)
+
+// JPEG markers used to split the stream
+const (
+	markerPrefix = 0xFF
+	markerSOI    = 0xD8
+	markerEOI    = 0xD9
+	markerSOS    = 0xDA
+	markerTEM    = 0x01
+	markerRST0   = 0xD0
+	markerRST7   = 0xD7
+)
+
+// MJPEGReader splits a raw MJPEG byte stream, as produced by
+// `ffmpeg -f mjpeg -` and similar tools, into individual JPEG images.
+//
+// Marker segments are skipped using their declared lengths, so SOI and EOI
+// bytes inside metadata such as an EXIF thumbnail do not end a frame early.
+// Bytes outside a frame are discarded, and a frame interrupted by a new SOI
+// is dropped in favour of the new one.
+type MJPEGReader struct {
+	r            *bufio.Reader
+	maxFrameSize int
+	buf          []byte
+}
+
+func NewMJPEGReader(r io.Reader, maxFrameSize int) *MJPEGReader {
+	if maxFrameSize <= 0 {
+		maxFrameSize = DefaultMaxFrameSize
+	}
+	return &MJPEGReader{
+		r:            bufio.NewReaderSize(r, 64*1024),
+		maxFrameSize: maxFrameSize,
+	}
+}
+
+// Next returns the next complete JPEG in the stream. The returned slice is
+// only valid until the following call. At the end of the stream Next returns
+// io.EOF, or io.ErrUnexpectedEOF if the stream ended mid-frame.
+func (m *MJPEGReader) Next() ([]byte, error) {
+	if err := m.findSOI(); err != nil {
+		return nil, err
+	}
+
+	var marker byte
+	var pending bool
+	for {
+		if !pending {
+			var err error
+			if marker, err = m.readMarker(); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			if marker == 0x00 {
+				return nil, fmt.Errorf("%w: stuffed byte outside scan data", ErrCorruptStream)
+			}
+		}
+		pending = false
+
+		switch {
+		case marker == markerEOI:
+			m.buf = append(m.buf, markerPrefix, markerEOI)
+			return m.buf, nil
+
+		case marker == markerSOI:
+			// The previous frame was cut short; start over with this one
+			m.buf = append(m.buf[:0], markerPrefix, markerSOI)
+
+		case marker == markerTEM || (marker >= markerRST0 && marker <= markerRST7):
+			m.buf = append(m.buf, markerPrefix, marker)
+
+		default:
+			if err := m.readSegment(marker); err != nil {
+				return nil, err
+			}
+			if marker == markerSOS {
+				var err error
+				if marker, err = m.readEntropyData(); err != nil {
+					return nil, err
+				}
+				pending = true
+			}
+		}
+
+		if len(m.buf) > m.maxFrameSize {
+			m.buf = m.buf[:0]
+			return nil, ErrFrameTooLarge
+		}
+	}
+}
+
+// findSOI discards bytes until the start of the next image and leaves the
+// SOI marker in the frame buffer.
+func (m *MJPEGReader) findSOI() error {
+	m.buf = m.buf[:0]
+	prev := byte(0)
+	for {
+		b, err := m.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if prev == markerPrefix && b == markerSOI {
+			m.buf = append(m.buf, markerPrefix, markerSOI)
+			return nil
+		}
+		prev = b
+	}
+}
+
+// readMarker reads the next marker, skipping any 0xFF fill bytes.
+func (m *MJPEGReader) readMarker() (byte, error) {
+	b, err := m.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != markerPrefix {
+		return 0, fmt.Errorf("%w: expected marker, got 0x%02x", ErrCorruptStream, b)
+	}
+	for b == markerPrefix {
+		if b, err = m.r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+	return b, nil
+}
+
+// readSegment copies a length-prefixed marker segment into the frame.
+func (m *MJPEGReader) readSegment(marker byte) error {
+	var length [2]byte
+	if _, err := io.ReadFull(m.r, length[:]); err != nil {
+		return unexpectedEOF(err)
+	}
+	n := int(length[0])<<8 | int(length[1])
+	if n < 2 {
+		return fmt.Errorf("%w: invalid segment length %d", ErrCorruptStream, n)
+	}
+	if len(m.buf)+n > m.maxFrameSize {
+		m.buf = m.buf[:0]
+		return ErrFrameTooLarge
+	}
+
+	m.buf = append(m.buf, markerPrefix, marker, length[0], length[1])
+	start := len(m.buf)
+	m.buf = append(m.buf, make([]byte, n-2)...)
+	if _, err := io.ReadFull(m.r, m.buf[start:]); err != nil {
+		return unexpectedEOF(err)
+	}
+	return nil
+}
+
+// readEntropyData copies scan data into the frame and returns the marker
+// that ends it. Stuffed 0xFF00 bytes and restart markers are part of the
+// scan.
+func (m *MJPEGReader) readEntropyData() (byte, error) {
+	for {
+		chunk, err := m.r.ReadSlice(markerPrefix)
+		if err != nil && err != bufio.ErrBufferFull {
+			return 0, unexpectedEOF(err)
+		}
+		m.buf = append(m.buf, chunk...)
+		if len(m.buf) > m.maxFrameSize {
+			m.buf = m.buf[:0]
+			return 0, ErrFrameTooLarge
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+
+		// chunk ended with 0xFF; the next byte decides what it was
+		next, err := m.r.ReadByte()
+		for err == nil && next == markerPrefix {
+			next, err = m.r.ReadByte()
+		}
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		if next == 0x00 || (next >= markerRST0 && next <= markerRST7) {
+			m.buf = append(m.buf, next)
+			continue
+		}
+
+		// A real marker ends the scan
+		m.buf = m.buf[:len(m.buf)-1]
+		return next, nil
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,145 @@
+package ingest
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"testing"
+)
+
+func encodeFrame(t *testing.T, shade uint8) []byte {
+	t.Helper()
+	return encodeSizedFrame(t, 32, 24, shade)
+}
+
+func encodeSizedFrame(t *testing.T, width, height int, shade uint8) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = shade + uint8(i%7)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("Failed to encode frame: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// withAPP1 inserts an APP1 segment after SOI whose payload contains SOI and
+// EOI byte sequences, as an embedded EXIF thumbnail would.
+func withAPP1(frame []byte) []byte {
+	payload := []byte("Exif\x00\x00\xFF\xD8thumbnail\xFF\xD9")
+	segment := []byte{0xFF, 0xE1, 0x00, byte(len(payload) + 2)}
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, frame[:2]...)
+	out = append(out, segment...)
+	return append(out, frame[2:]...)
+}
+
+func readAll(t *testing.T, r *MJPEGReader) ([][]byte, []error) {
+	t.Helper()
+	var frames [][]byte
+	var errs []error
+	for {
+		data, err := r.Next()
+		if err == io.EOF {
+			return frames, errs
+		}
+		if err != nil {
+			errs = append(errs, err)
+			if err == io.ErrUnexpectedEOF {
+				return frames, errs
+			}
+			continue
+		}
+		frames = append(frames, append([]byte{}, data...))
+	}
+}
+
+func TestMJPEGReaderSplitsFrames(t *testing.T) {
+	a, b, c := encodeFrame(t, 10), encodeFrame(t, 100), encodeFrame(t, 200)
+	stream := bytes.Join([][]byte{a, b, c}, nil)
+
+	frames, errs := readAll(t, NewMJPEGReader(bytes.NewReader(stream), 0))
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("Expected 3 frames, got %d", len(frames))
+	}
+	for i, expected := range [][]byte{a, b, c} {
+		if !bytes.Equal(frames[i], expected) {
+			t.Errorf("Frame %d does not match the encoded image", i)
+		}
+	}
+}
+
+func TestMJPEGReaderSkipsEmbeddedMarkers(t *testing.T) {
+	a, b := withAPP1(encodeFrame(t, 10)), encodeFrame(t, 100)
+	stream := append(append([]byte{}, a...), b...)
+
+	frames, errs := readAll(t, NewMJPEGReader(bytes.NewReader(stream), 0))
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	if len(frames) != 2 || !bytes.Equal(frames[0], a) || !bytes.Equal(frames[1], b) {
+		t.Fatalf("EOI inside APP1 should not split the frame, got %d frames", len(frames))
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(frames[0])); err != nil {
+		t.Errorf("Frame with APP1 should decode: %v", err)
+	}
+}
+
+func TestMJPEGReaderResynchronises(t *testing.T) {
+	a, b := encodeFrame(t, 10), encodeFrame(t, 100)
+
+	var stream []byte
+	stream = append(stream, "garbage before the first frame"...)
+	stream = append(stream, a...)
+	stream = append(stream, "\x00\x01garbage\xFF between"...)
+	// A frame cut off mid-scan, immediately followed by a new one
+	stream = append(stream, a[:len(a)-20]...)
+	stream = append(stream, b...)
+
+	frames, _ := readAll(t, NewMJPEGReader(bytes.NewReader(stream), 0))
+	if len(frames) != 2 {
+		t.Fatalf("Expected 2 frames, got %d", len(frames))
+	}
+	if !bytes.Equal(frames[0], a) || !bytes.Equal(frames[1], b) {
+		t.Error("Frames around garbage should be recovered intact")
+	}
+}
+
+func TestMJPEGReaderTruncatedStream(t *testing.T) {
+	a := encodeFrame(t, 10)
+	stream := append(append([]byte{}, a...), a[:len(a)-10]...)
+
+	r := NewMJPEGReader(bytes.NewReader(stream), 0)
+	if _, err := r.Next(); err != nil {
+		t.Fatalf("First frame should be complete: %v", err)
+	}
+	if _, err := r.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestMJPEGReaderMaxFrameSize(t *testing.T) {
+	big, small := encodeSizedFrame(t, 320, 240, 10), encodeFrame(t, 200)
+
+	stream := append(append([]byte{}, big...), small...)
+	r := NewMJPEGReader(bytes.NewReader(stream), len(small)+1)
+
+	if _, err := r.Next(); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("Expected ErrFrameTooLarge, got %v", err)
+	}
+	data, err := r.Next()
+	if err != nil {
+		t.Fatalf("Reader should recover after an oversized frame: %v", err)
+	}
+	if !bytes.Equal(data, small) {
+		t.Error("Expected the next frame after the oversized one")
+	}
+}
@@ -0,0 +1,104 @@
+package ingest
+
+import (
+	"log"
+	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+	"github.com/bs-frame-monitor/pkg/shmring"
+)
+
+// ShmSource publishes frames from a shared-memory ring created by a
+// producer, typically in /dev/shm. The ring is polled, so no file is opened
+// and no syscall is made per frame.
+type ShmSource struct {
+	path  string
+	cache *cache.ImageCache
+	cfg   config
+
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+func NewShmSource(path string, cache *cache.ImageCache, opts ...Option) *ShmSource {
+	return &ShmSource{
+		path:   path,
+		cache:  cache,
+		cfg:    newConfig(opts),
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (s *ShmSource) Start() {
+	s.cache.SetSource("shm:" + s.path)
+	log.Printf("Polling shared-memory ring %s every %v", s.path, s.cfg.pollInterval)
+	go s.run()
+}
+
+func (s *ShmSource) Stop() {
+	close(s.stopCh)
+	<-s.done
+}
+
+func (s *ShmSource) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.cfg.pollInterval)
+	defer ticker.Stop()
+
+	var reader *shmring.Reader
+	defer func() {
+		if reader != nil {
+			reader.Close()
+		}
+	}()
+
+	var buf []byte
+	var lastCheck time.Time
+	for {
+		// The ring file is only checked for replacement occasionally, so
+		// polling for frames stays free of syscalls
+		if reader == nil || time.Since(lastCheck) >= reopenDelay {
+			lastCheck = time.Now()
+			reader = s.checkRing(reader)
+		}
+
+		if reader != nil {
+			if frame, ok := reader.Next(buf); ok {
+				buf = frame.Data
+				if err := Publish(s.cache, s.cfg.input, frame.Data, frame.CapturedAt); err != nil {
+					log.Printf("Rejected frame %d from %s: %v", frame.Seq, s.path, err)
+				}
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// checkRing reopens the ring if the producer recreated or removed it, and
+// returns the reader to use, which is nil while there is no ring.
+func (s *ShmSource) checkRing(reader *shmring.Reader) *shmring.Reader {
+	if reader != nil {
+		if !reader.Replaced(s.path) {
+			return reader
+		}
+		reader.Close()
+		log.Printf("Shared-memory ring %s was replaced", s.path)
+	}
+
+	reader, err := shmring.Open(s.path)
+	if err != nil {
+		if s.cache.MarkMissing() {
+			log.Printf("Shared-memory ring %s unavailable: %v", s.path, err)
+		}
+		return nil
+	}
+	log.Printf("Opened shared-memory ring %s", s.path)
+	return reader
+}
@@ -0,0 +1,57 @@
+package ingest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+	"github.com/bs-frame-monitor/pkg/shmring"
+)
+
+func TestShmSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frames")
+	imageCache := cache.NewImageCache()
+	source := NewShmSource(path, imageCache, WithPollInterval(time.Millisecond))
+	source.Start()
+	defer source.Stop()
+
+	waitFor(t, func() bool { return imageCache.Status().State == cache.StateMissing })
+
+	writer, err := shmring.Create(path, 4, 64*1024)
+	if err != nil {
+		t.Fatalf("Failed to create ring: %v", err)
+	}
+
+	captured := time.Now().Add(-time.Second).Truncate(time.Microsecond)
+	frame := encodeFrame(t, 10)
+	writer.Write(frame, captured)
+	waitFor(t, imageCache.HasData)
+
+	latest, _ := imageCache.Latest()
+	if !bytes.Equal(latest.Data, frame) || !latest.ModTime.Equal(captured) {
+		t.Errorf("Expected frame with the ring's capture time, got mod time %v", latest.ModTime)
+	}
+
+	writer.Write([]byte("not a jpeg"), time.Now())
+	waitFor(t, func() bool { return imageCache.Rejected() == 1 })
+
+	// A restarted producer recreates the ring and is picked up
+	writer.Close()
+	writer, err = shmring.Create(path, 4, 64*1024)
+	if err != nil {
+		t.Fatalf("Failed to recreate ring: %v", err)
+	}
+	defer writer.Close()
+	frame = encodeFrame(t, 100)
+	writer.Write(frame, time.Now())
+	waitFor(t, func() bool {
+		data, _, _, _ := imageCache.Get()
+		return bytes.Equal(data, frame)
+	})
+
+	os.Remove(path)
+	waitFor(t, func() bool { return imageCache.Status().State == cache.StateMissing })
+}
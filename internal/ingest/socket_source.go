@@ -0,0 +1,201 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+	"github.com/bs-frame-monitor/pkg/framesock"
+)
+
+// SocketSource listens on a Unix socket for producers sending frames in the
+// framesock protocol. Several producers may be connected at once; each is
+// reported in the cache status.
+type SocketSource struct {
+	path  string
+	cache *cache.ImageCache
+	cfg   config
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu        sync.Mutex
+	conns     map[net.Conn]struct{}
+	nextID    int
+	connected int
+	stopped   bool
+}
+
+func NewSocketSource(path string, cache *cache.ImageCache, opts ...Option) *SocketSource {
+	return &SocketSource{
+		path:  path,
+		cache: cache,
+		cfg:   newConfig(opts),
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// Start listens on the socket, replacing a stale socket file left behind
+// by an earlier run.
+func (s *SocketSource) Start() error {
+	if stat, err := os.Stat(s.path); err == nil {
+		if stat.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%s exists and is not a socket", s.path)
+		}
+		os.Remove(s.path)
+	}
+
+	listener, err := net.Listen("unix", s.path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.path, err)
+	}
+	s.listener = listener
+	s.cache.SetSource("unix:" + s.path)
+	log.Printf("Listening for frame producers on %s", s.path)
+
+	s.wg.Add(1)
+	go s.accept()
+	return nil
+}
+
+func (s *SocketSource) Stop() {
+	s.mu.Lock()
+	if s.stopped || s.listener == nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	s.listener.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	os.Remove(s.path)
+}
+
+func (s *SocketSource) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Socket %s accept error: %v", s.path, err)
+			}
+			return
+		}
+
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.nextID++
+		s.connected++
+		id := strconv.Itoa(s.nextID)
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serve(conn, id)
+	}
+}
+
+// serve reads frames from one producer until it disconnects. Producers are
+// tracked by ID until they send a name; named producers stay listed as
+// disconnected after they go away so a dead producer is visible in health.
+func (s *SocketSource) serve(conn net.Conn, id string) {
+	defer s.wg.Done()
+
+	producer := cache.Producer{
+		ID:          id,
+		Connected:   true,
+		ConnectedAt: time.Now(),
+	}
+	s.cache.SetProducer(producer)
+	log.Printf("Producer %s connected to %s", id, s.path)
+
+	reader := framesock.NewReader(conn, s.cfg.maxFrameSize)
+	for {
+		msg, err := reader.Next()
+		if errors.Is(err, framesock.ErrFrameTooLarge) {
+			producer.Rejected++
+			s.cache.RecordRejected()
+			s.cache.SetProducer(producer)
+			continue
+		}
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				log.Printf("Producer %s on %s: %v", producerLabel(producer), s.path, err)
+			}
+			break
+		}
+
+		err = s.publish(msg, &producer)
+		if err != nil {
+			producer.Rejected++
+			log.Printf("Rejected frame from producer %s on %s: %v", producerLabel(producer), s.path, err)
+		} else {
+			producer.Frames++
+			producer.LastFrameAt = time.Now()
+		}
+		s.cache.SetProducer(producer)
+	}
+
+	conn.Close()
+	log.Printf("Producer %s disconnected from %s", producerLabel(producer), s.path)
+
+	producer.Connected = false
+	producer.DisconnectedAt = time.Now()
+	if producer.Name != "" {
+		s.cache.SetProducer(producer)
+	} else {
+		s.cache.RemoveProducer(producer.ID)
+	}
+
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.connected--
+	last := s.connected == 0 && !s.stopped
+	s.mu.Unlock()
+
+	if last {
+		s.cache.MarkMissing()
+	}
+}
+
+func (s *SocketSource) publish(msg framesock.Message, producer *cache.Producer) error {
+	meta, err := msg.Metadata()
+	if err != nil {
+		s.cache.RecordRejected()
+		return err
+	}
+	if meta.Producer != "" && meta.Producer != producer.Name {
+		// A named producer replaces its entry from an earlier connection
+		s.cache.RemoveProducer(producer.ID)
+		producer.ID = "name:" + meta.Producer
+		producer.Name = meta.Producer
+	}
+
+	modTime := time.Now()
+	if meta.TimestampNs != 0 {
+		modTime = time.Unix(0, meta.TimestampNs)
+	}
+	return Publish(s.cache, s.cfg.input, msg.Frame, modTime)
+}
+
+func producerLabel(p cache.Producer) string {
+	if p.Name != "" {
+		return strconv.Quote(p.Name)
+	}
+	return p.ID
+}
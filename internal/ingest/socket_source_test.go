@@ -0,0 +1,86 @@
+package ingest
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+	"github.com/bs-frame-monitor/pkg/framesock"
+)
+
+func TestSocketSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frames.sock")
+	imageCache := cache.NewImageCache()
+	source := NewSocketSource(path, imageCache)
+	if err := source.Start(); err != nil {
+		t.Fatalf("Failed to start socket source: %v", err)
+	}
+	defer source.Stop()
+
+	client, err := framesock.Dial(path, "gaze")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	frame := encodeFrame(t, 10)
+	captured := time.Now().Add(-time.Second).Truncate(time.Millisecond)
+	client.SendWithMetadata(frame, framesock.Metadata{TimestampNs: captured.UnixNano()})
+	client.Send([]byte("not a jpeg"))
+
+	waitFor(t, func() bool {
+		producers := imageCache.Status().Producers
+		return len(producers) == 1 && producers[0].Rejected == 1
+	})
+
+	latest, _ := imageCache.Latest()
+	if !bytes.Equal(latest.Data, frame) || !latest.ModTime.Equal(captured) {
+		t.Errorf("Expected frame with the producer's timestamp, got mod time %v", latest.ModTime)
+	}
+	producer := imageCache.Status().Producers[0]
+	if producer.Name != "gaze" || !producer.Connected || producer.Frames != 1 {
+		t.Errorf("Unexpected producer state %+v", producer)
+	}
+
+	client.Close()
+	waitFor(t, func() bool {
+		status := imageCache.Status()
+		return status.State == cache.StateMissing && len(status.Producers) == 1 && !status.Producers[0].Connected
+	})
+
+	// The same producer reconnecting replaces its old entry
+	client, err = framesock.Dial(path, "gaze")
+	if err != nil {
+		t.Fatalf("Failed to reconnect: %v", err)
+	}
+	defer client.Close()
+	client.Send(encodeFrame(t, 100))
+	waitFor(t, func() bool {
+		status := imageCache.Status()
+		return status.State == cache.StateOK && len(status.Producers) == 1 && status.Producers[0].Connected
+	})
+}
+
+func TestSocketSourceAnonymousProducers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frames.sock")
+	imageCache := cache.NewImageCache()
+	source := NewSocketSource(path, imageCache)
+	if err := source.Start(); err != nil {
+		t.Fatalf("Failed to start socket source: %v", err)
+	}
+	defer source.Stop()
+
+	a, _ := framesock.Dial(path, "")
+	b, _ := framesock.Dial(path, "")
+	waitFor(t, func() bool { return len(imageCache.Status().Producers) == 2 })
+
+	a.Close()
+	waitFor(t, func() bool { return len(imageCache.Status().Producers) == 1 })
+	if imageCache.Status().State == cache.StateMissing {
+		t.Error("Source should not be missing while a producer is connected")
+	}
+
+	b.Close()
+	waitFor(t, func() bool { return imageCache.Status().State == cache.StateMissing })
+}
@@ -0,0 +1,219 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+)
+
+const reopenDelay = time.Second
+
+// StreamSource reads a raw MJPEG byte stream from stdin, a FIFO or any
+// reader and publishes each JPEG it contains.
+type StreamSource struct {
+	name  string
+	cache *cache.ImageCache
+	cfg   config
+
+	open   func() (io.ReadCloser, error)
+	reopen bool
+	// wake unblocks an open that is waiting for a producer, if needed
+	wake func()
+
+	mu      sync.Mutex
+	reader  io.ReadCloser
+	stopped bool
+	stopCh  chan struct{}
+	done    chan struct{}
+}
+
+func newStreamSource(name string, cache *cache.ImageCache, opts []Option) *StreamSource {
+	return &StreamSource{
+		name:   name,
+		cache:  cache,
+		cfg:    newConfig(opts),
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// NewStdinSource reads frames from standard input, e.g. piped from
+// `ffmpeg ... -f mjpeg -`. The source ends when stdin is closed.
+func NewStdinSource(cache *cache.ImageCache, opts ...Option) *StreamSource {
+	s := newStreamSource("stdin", cache, opts)
+	s.open = func() (io.ReadCloser, error) {
+		return os.Stdin, nil
+	}
+	return s
+}
+
+// NewFIFOSource reads frames from the named pipe at path, creating it if it
+// does not exist. When a producer closes the pipe the source waits for the
+// next one.
+func NewFIFOSource(path string, cache *cache.ImageCache, opts ...Option) *StreamSource {
+	s := newStreamSource("fifo:"+path, cache, opts)
+	s.reopen = true
+	s.open = func() (io.ReadCloser, error) {
+		if err := ensureFIFO(path); err != nil {
+			return nil, err
+		}
+		// Blocks until a producer opens the pipe for writing
+		return os.Open(path)
+	}
+	s.wake = func() {
+		// Briefly acting as a writer releases a reader blocked in open
+		if f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+			f.Close()
+		}
+	}
+	return s
+}
+
+// NewReaderSource reads frames from r. The source ends at the end of r, and
+// Stop closes r if it is an io.Closer.
+func NewReaderSource(name string, r io.Reader, cache *cache.ImageCache, opts ...Option) *StreamSource {
+	s := newStreamSource(name, cache, opts)
+	s.open = func() (io.ReadCloser, error) {
+		if rc, ok := r.(io.ReadCloser); ok {
+			return rc, nil
+		}
+		return io.NopCloser(r), nil
+	}
+	return s
+}
+
+func ensureFIFO(path string) error {
+	stat, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		if err := syscall.Mkfifo(path, 0666); err != nil {
+			return fmt.Errorf("failed to create FIFO %s: %w", path, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if stat.Mode()&os.ModeNamedPipe == 0 {
+		return fmt.Errorf("%s exists and is not a FIFO", path)
+	}
+	return nil
+}
+
+func (s *StreamSource) Start() {
+	s.cache.SetSource(s.name)
+	log.Printf("Reading MJPEG frames from %s", s.name)
+	go s.run()
+}
+
+func (s *StreamSource) Stop() {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	close(s.stopCh)
+	if s.reader != nil {
+		s.reader.Close()
+	}
+	s.mu.Unlock()
+
+	for s.wake != nil {
+		// Retried in case the reader had not reached open yet
+		s.wake()
+		select {
+		case <-s.done:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	<-s.done
+}
+
+func (s *StreamSource) run() {
+	defer close(s.done)
+
+	for {
+		r, err := s.open()
+		if err != nil {
+			log.Printf("Failed to open %s: %v", s.name, err)
+			if !s.reopen || !s.sleep(reopenDelay) {
+				return
+			}
+			continue
+		}
+
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			r.Close()
+			return
+		}
+		s.reader = r
+		s.mu.Unlock()
+
+		s.readFrames(r)
+
+		s.mu.Lock()
+		s.reader = nil
+		stopped := s.stopped
+		s.mu.Unlock()
+		r.Close()
+
+		if stopped {
+			return
+		}
+		if s.cache.MarkMissing() {
+			log.Printf("Producer disconnected from %s", s.name)
+		}
+		if !s.reopen {
+			return
+		}
+	}
+}
+
+// readFrames publishes frames until the stream ends. Corrupt or oversized
+// frames are rejected and the reader resynchronises on the next one.
+func (s *StreamSource) readFrames(r io.Reader) {
+	reader := NewMJPEGReader(r, s.cfg.maxFrameSize)
+	for {
+		data, err := reader.Next()
+		switch {
+		case err == nil:
+			if err := Publish(s.cache, s.cfg.input, data, time.Now()); err != nil {
+				log.Printf("Rejected frame from %s: %v", s.name, err)
+			}
+		case errors.Is(err, ErrCorruptStream) || errors.Is(err, ErrFrameTooLarge):
+			s.cache.RecordRejected()
+			log.Printf("Rejected frame from %s: %v", s.name, err)
+		default:
+			if err != io.EOF && !s.isStopped() {
+				log.Printf("Error reading %s: %v", s.name, err)
+			}
+			return
+		}
+	}
+}
+
+func (s *StreamSource) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+// sleep waits for d and reports false if the source was stopped meanwhile.
+func (s *StreamSource) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-s.stopCh:
+		return false
+	}
+}
@@ -0,0 +1,124 @@
+package ingest
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+)
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReaderSourcePublishesFrames(t *testing.T) {
+	pr, pw := io.Pipe()
+	imageCache := cache.NewImageCache()
+	source := NewReaderSource("test", pr, imageCache)
+	source.Start()
+	defer source.Stop()
+
+	if status := imageCache.Status(); status.Source != "test" {
+		t.Errorf("Expected source name to be recorded, got %q", status.Source)
+	}
+
+	a, b := encodeFrame(t, 10), encodeFrame(t, 100)
+	pw.Write(a)
+	waitFor(t, imageCache.HasData)
+	if data, _, _, _ := imageCache.Get(); !bytes.Equal(data, a) {
+		t.Error("Expected the first frame to be cached")
+	}
+
+	pw.Write([]byte("noise"))
+	pw.Write(b)
+	waitFor(t, func() bool {
+		data, _, _, _ := imageCache.Get()
+		return bytes.Equal(data, b)
+	})
+
+	pw.Close()
+	waitFor(t, func() bool {
+		return imageCache.Status().State == cache.StateMissing
+	})
+}
+
+func TestReaderSourceRejectsOversizedFrames(t *testing.T) {
+	big, small := encodeSizedFrame(t, 320, 240, 10), encodeFrame(t, 100)
+	stream := append(append([]byte{}, big...), small...)
+
+	imageCache := cache.NewImageCache()
+	source := NewReaderSource("test", bytes.NewReader(stream), imageCache, WithMaxFrameSize(len(small)+1))
+	source.Start()
+	defer source.Stop()
+
+	waitFor(t, imageCache.HasData)
+	if data, _, _, _ := imageCache.Get(); !bytes.Equal(data, small) {
+		t.Error("Expected the frame after the oversized one to be cached")
+	}
+	if imageCache.Rejected() != 1 {
+		t.Errorf("Expected 1 rejected frame, got %d", imageCache.Rejected())
+	}
+}
+
+func TestFIFOSourceReopens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frames.fifo")
+	imageCache := cache.NewImageCache()
+	source := NewFIFOSource(path, imageCache)
+	source.Start()
+	defer source.Stop()
+
+	writeFIFO := func(frame []byte) {
+		var f *os.File
+		waitFor(t, func() bool {
+			var err error
+			f, err = os.OpenFile(path, os.O_WRONLY, 0)
+			return err == nil
+		})
+		defer f.Close()
+		if _, err := f.Write(frame); err != nil {
+			t.Fatalf("Failed to write to FIFO: %v", err)
+		}
+	}
+
+	a, b := encodeFrame(t, 10), encodeFrame(t, 100)
+	writeFIFO(a)
+	waitFor(t, func() bool {
+		data, _, _, _ := imageCache.Get()
+		return bytes.Equal(data, a)
+	})
+
+	// A second producer is picked up after the first disconnects
+	writeFIFO(b)
+	waitFor(t, func() bool {
+		data, _, _, _ := imageCache.Get()
+		return bytes.Equal(data, b)
+	})
+}
+
+func TestFIFOSourceStopWithoutProducer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frames.fifo")
+	source := NewFIFOSource(path, cache.NewImageCache())
+	source.Start()
+
+	done := make(chan struct{})
+	go func() {
+		source.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop should not block while waiting for a producer")
+	}
+}
@@ -1,6 +1,7 @@
 package monitor
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -8,68 +9,221 @@ import (
 	"time"
 
 	"github.com/bs-frame-monitor/internal/cache"
+	"github.com/bs-frame-monitor/internal/imaging"
 	"github.com/fsnotify/fsnotify"
 )
 
+// WatchMode selects how the monitor notices changes to the watched file.
+type WatchMode string
+
+const (
+	// WatchFsnotify reacts to inotify events only.
+	WatchFsnotify WatchMode = "fsnotify"
+	// WatchPoll stats the file at the monitor interval. It works on mounts
+	// where inotify events never arrive, such as overlay, NFS and FUSE.
+	WatchPoll WatchMode = "poll"
+	// WatchHybrid reacts to inotify events and also polls as a safety net.
+	WatchHybrid WatchMode = "hybrid"
+)
+
+const defaultPollInterval = 33 * time.Millisecond
+
+// mtimeGranularity is the coarsest modification time resolution expected,
+// that of FAT. A file rewritten within one tick at the same size keeps its
+// stat, so polling reads a file that recent again to catch the rewrite.
+const mtimeGranularity = 2 * time.Second
+
+// Incomplete reads are retried with exponential backoff, giving a producer
+// that is mid-write roughly 60ms to finish before the frame is rejected.
+const (
+	initialRetryDelay = 2 * time.Millisecond
+	maxReadRetries    = 5
+)
+
+func ParseWatchMode(s string) (WatchMode, error) {
+	switch mode := WatchMode(s); mode {
+	case WatchFsnotify, WatchPoll, WatchHybrid:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown watch mode %q (want fsnotify, poll or hybrid)", s)
+	}
+}
+
 type FileMonitor struct {
 	filePath string
 	cache    *cache.ImageCache
+	interval time.Duration
+	mode     WatchMode
+	input    imaging.Input
 	watcher  *fsnotify.Watcher
 	stopCh   chan struct{}
+
+	// Directory and glob sources watch a sequence of frame files. pattern
+	// is empty when a single file is watched.
+	pattern string
+	order   SequenceOrder
+	cleanup bool
+	// rejected holds the state of sequence files that failed validation
+	rejected map[string]os.FileInfo
+
+	// Optional JSON file, such as detection results, paired with the frame
+	// modified closest to it; see sidecar.go
+	sidecar        string
+	sidecarMaxSkew time.Duration
+	side           sidecarState
+
+	// File currently being served and its last observed state, used to
+	// detect changes when polling
+	current  string
+	lastStat os.FileInfo
+}
+
+type Option func(*FileMonitor)
+
+// WithValidation sets how each read is checked before it is cached. Reads
+// that fail validation are retried and then rejected, keeping the last good
+// frame in the cache.
+func WithValidation(level imaging.ValidationLevel) Option {
+	return func(fm *FileMonitor) {
+		fm.input.Validation = level
+	}
+}
+
+// WithTranscodeQuality sets the JPEG quality used when the watched file is a
+// PNG, GIF, BMP, TIFF or WebP image.
+func WithTranscodeQuality(quality int) Option {
+	return func(fm *FileMonitor) {
+		fm.input.TranscodeQuality = quality
+	}
+}
+
+func WithWatchMode(mode WatchMode) Option {
+	return func(fm *FileMonitor) {
+		fm.mode = mode
+	}
 }
 
-func NewFileMonitor(filePath string, cache *cache.ImageCache, _ time.Duration) *FileMonitor {
-	return &FileMonitor{
+// NewFileMonitor creates a monitor for filePath. The interval sets how often
+// the file is polled in the poll and hybrid watch modes. If filePath is a
+// directory or a glob pattern such as /tmp/frames/frame_*.jpg, the newest
+// matching file is served instead; see WithSequenceOrder and WithCleanup.
+func NewFileMonitor(filePath string, cache *cache.ImageCache, interval time.Duration, opts ...Option) *FileMonitor {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	fm := &FileMonitor{
 		filePath: filePath,
 		cache:    cache,
+		interval: interval,
+		mode:     WatchFsnotify,
+		input:    imaging.DefaultInput,
+		order:    OrderByName,
+		rejected: make(map[string]os.FileInfo),
 		stopCh:   make(chan struct{}),
+
+		sidecarMaxSkew: DefaultSidecarMaxSkew,
+	}
+	for _, opt := range opts {
+		opt(fm)
+	}
+
+	fm.pattern = sequencePattern(filePath)
+	if fm.pattern == "" {
+		fm.current = filePath
 	}
+	return fm
+}
+
+// Mode returns the active watch mode, which may differ from the requested
+// one if inotify was unavailable and the monitor fell back to polling.
+func (fm *FileMonitor) Mode() WatchMode {
+	return fm.mode
 }
 
 func (fm *FileMonitor) Start() {
-	var err error
-	fm.watcher, err = fsnotify.NewWatcher()
-	if err != nil {
-		log.Fatalf("Failed to create file watcher: %v", err)
-	}
+	fm.cache.SetSource(fm.filePath)
 
 	// Load initial image if it exists
-	fm.readAndCacheImage()
+	if fm.sidecar != "" {
+		fm.loadSidecar()
+	}
+	if fm.pattern == "" {
+		fm.readAndCacheImage(fm.filePath)
+	} else {
+		fm.pollSequence()
+	}
 
-	// Watch the directory, not the file (file may be recreated)
-	dir := filepath.Dir(fm.filePath)
-	if err := fm.watcher.Add(dir); err != nil {
-		log.Fatalf("Failed to watch directory %s: %v", dir, err)
+	if fm.mode != WatchPoll {
+		if err := fm.startWatcher(); err != nil {
+			log.Printf("inotify unavailable (%v), falling back to polling every %v", err, fm.interval)
+			fm.mode = WatchPoll
+		}
 	}
 
-	log.Printf("Watching for changes to %s", fm.filePath)
+	log.Printf("Watching for changes to %s (mode: %s)", fm.filePath, fm.mode)
+
+	// Nil channels never fire, so unused watch sources simply drop out
+	var events chan fsnotify.Event
+	var watchErrors chan error
+	if fm.watcher != nil {
+		events = fm.watcher.Events
+		watchErrors = fm.watcher.Errors
+	}
 
 	go func() {
+		var poll <-chan time.Time
+		if fm.mode != WatchFsnotify {
+			ticker := time.NewTicker(fm.interval)
+			defer ticker.Stop()
+			poll = ticker.C
+		}
+
 		for {
 			select {
-			case event, ok := <-fm.watcher.Events:
+			case event, ok := <-events:
 				if !ok {
 					return
 				}
 
+				if fm.sidecar != "" && event.Name == fm.sidecar {
+					fm.loadSidecar()
+					continue
+				}
+
+				if fm.pattern != "" {
+					fm.handleSequenceEvent(event)
+					continue
+				}
+
 				// Only process events for our specific file
 				if event.Name != fm.filePath {
 					continue
 				}
 
-				// React to file writes and creates
-				if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
-					// Small delay to ensure write is complete
-					time.Sleep(5 * time.Millisecond)
-					fm.readAndCacheImage()
+				// An atomic rename-into-place arrives as Create on our path and
+				// yields a complete file. Writes may be observed mid-write and
+				// are retried until the JPEG validates. Remove and Rename mean
+				// the file went away, which the read reports as missing.
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+					fm.readAndCacheImage(fm.filePath)
 				}
 
-			case err, ok := <-fm.watcher.Errors:
+			case err, ok := <-watchErrors:
 				if !ok {
 					return
 				}
 				log.Printf("File watcher error: %v", err)
 
+			case <-poll:
+				if fm.sidecar != "" {
+					fm.loadSidecar()
+				}
+				if fm.pattern == "" {
+					fm.pollFile()
+				} else {
+					fm.pollSequence()
+				}
+
 			case <-fm.stopCh:
 				return
 			}
@@ -77,6 +231,32 @@ func (fm *FileMonitor) Start() {
 	}()
 }
 
+func (fm *FileMonitor) startWatcher() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	// Watch the directory, not the file (file may be recreated)
+	dir := filepath.Dir(fm.filePath)
+	if fm.pattern != "" {
+		dir = filepath.Dir(fm.pattern)
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch directory %s: %w", dir, err)
+	}
+	if side := filepath.Dir(fm.sidecar); fm.sidecar != "" && side != dir {
+		if err := watcher.Add(side); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch directory %s: %w", side, err)
+		}
+	}
+
+	fm.watcher = watcher
+	return nil
+}
+
 func (fm *FileMonitor) Stop() {
 	if fm.watcher != nil {
 		fm.watcher.Close()
@@ -84,28 +264,121 @@ func (fm *FileMonitor) Stop() {
 	close(fm.stopCh)
 }
 
-func (fm *FileMonitor) readAndCacheImage() {
+// pollFile reloads the image if it was replaced or its modification time or
+// size changed since it was last read, or while its modification time is
+// too recent to tell. Rereading an unchanged file publishes nothing, as the
+// cache skips byte-identical frames.
+func (fm *FileMonitor) pollFile() {
 	stat, err := os.Stat(fm.filePath)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			log.Printf("Error checking file %s: %v", fm.filePath, err)
+		if os.IsNotExist(err) {
+			fm.markMissing()
 		}
 		return
 	}
+	if fm.unchanged(stat) && time.Since(stat.ModTime()) > mtimeGranularity {
+		return
+	}
+	fm.readAndCacheImage(fm.filePath)
+}
 
-	file, err := os.Open(fm.filePath)
+// unchanged reports whether stat describes the same file state that was last
+// read.
+func (fm *FileMonitor) unchanged(stat os.FileInfo) bool {
+	return fm.lastStat != nil && sameState(stat, fm.lastStat)
+}
+
+// sameState reports whether two stats describe the same file with the same
+// modification time and size.
+func sameState(a, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
+
+// readAndCacheImage reads path and publishes it once it validates. Torn
+// reads are retried with backoff; if the file never validates the frame is
+// rejected and the cache keeps serving the last good one. It reports whether
+// the file validated.
+func (fm *FileMonitor) readAndCacheImage(path string) bool {
+	delay := initialRetryDelay
+	for attempt := 0; ; attempt++ {
+		data, stat, err := readFile(path)
+		if err != nil {
+			switch {
+			case !os.IsNotExist(err):
+				log.Printf("Error reading file %s: %v", path, err)
+			case fm.pattern == "":
+				fm.markMissing()
+			}
+			// A vanished sequence frame is expected; the next poll or
+			// event picks up its successor
+			return false
+		}
+		fm.current = path
+		fm.lastStat = stat
+
+		frame, err := fm.input.Prepare(data)
+		if err == nil {
+			// The same image written again keeps its detections rather
+			// than becoming a new frame without them, and a reread of the
+			// same write keeps them rather than taking a sidecar held for
+			// the next frame
+			metadata := fm.sidecarFor(stat.ModTime())
+			if latest, ok := fm.cache.Latest(); ok && latest.Hash == cache.ContentHash(frame) &&
+				(metadata == nil || latest.ModTime.Equal(stat.ModTime())) {
+				metadata = latest.Metadata
+			}
+			if fm.cache.UpdateWithMetadata(frame, metadata, stat.ModTime(), int64(len(frame))) && metadata != nil {
+				if latest, ok := fm.cache.Latest(); ok {
+					fm.pairedSidecar(latest.Seq, stat.ModTime())
+				}
+			}
+			delete(fm.rejected, path)
+			if fm.pattern != "" && fm.cleanup {
+				fm.removeOlderFrames(path, stat)
+			}
+			return true
+		}
+
+		if attempt == maxReadRetries {
+			fm.cache.RecordRejected()
+			if fm.pattern != "" {
+				fm.rejected[path] = stat
+			}
+			log.Printf("Rejected frame from %s after %d attempts: %v", path, attempt+1, err)
+			return false
+		}
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-fm.stopCh:
+			return false
+		}
+	}
+}
+
+func (fm *FileMonitor) markMissing() {
+	fm.lastStat = nil
+	if fm.cache.MarkMissing() {
+		log.Printf("Source %s is missing", fm.filePath)
+	}
+}
+
+func readFile(path string) ([]byte, os.FileInfo, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		log.Printf("Error opening file %s: %v", fm.filePath, err)
-		return
+		return nil, nil, err
 	}
 	defer file.Close()
 
-	data, err := io.ReadAll(file)
+	stat, err := file.Stat()
 	if err != nil {
-		log.Printf("Error reading file %s: %v", fm.filePath, err)
-		return
+		return nil, nil, err
 	}
 
-	modTime := stat.ModTime()
-	fm.cache.Update(data, modTime, stat.Size())
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, stat, nil
 }
@@ -1,12 +1,17 @@
 package monitor
 
 import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/bs-frame-monitor/internal/cache"
+	"github.com/bs-frame-monitor/internal/imaging"
 )
 
 func createTempFile(t *testing.T, content []byte) string {
@@ -178,3 +183,407 @@ func TestFileMonitorIgnoresUnchangedFile(t *testing.T) {
 		t.Error("Modification time should not change for unchanged file")
 	}
 }
+
+func TestParseWatchMode(t *testing.T) {
+	for _, mode := range []WatchMode{WatchFsnotify, WatchPoll, WatchHybrid} {
+		parsed, err := ParseWatchMode(string(mode))
+		if err != nil || parsed != mode {
+			t.Errorf("ParseWatchMode(%q) = %q, %v", mode, parsed, err)
+		}
+	}
+
+	if _, err := ParseWatchMode("inotify"); err == nil {
+		t.Error("ParseWatchMode should reject unknown modes")
+	}
+}
+
+func TestFileMonitorPollMode(t *testing.T) {
+	cache := cache.NewImageCache()
+	initialData := createValidJPEG("initial content")
+	filePath := createTempFile(t, initialData)
+
+	monitor := NewFileMonitor(filePath, cache, time.Millisecond*10, WithWatchMode(WatchPoll))
+	monitor.Start()
+	defer monitor.Stop()
+
+	if monitor.watcher != nil {
+		t.Error("Poll mode should not create an inotify watcher")
+	}
+
+	time.Sleep(time.Millisecond * 50)
+
+	updatedData := createValidJPEG("updated by poll")
+	if err := os.WriteFile(filePath, updatedData, 0644); err != nil {
+		t.Fatalf("Failed to update file: %v", err)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+
+	data, _, _, ok := cache.Get()
+	if !ok || string(data) != string(updatedData) {
+		t.Errorf("Poll mode should pick up file changes, got %q", string(data))
+	}
+}
+
+func TestFileMonitorPollModeCoarseModTime(t *testing.T) {
+	cache := cache.NewImageCache()
+	filePath := createTempFile(t, createValidJPEG("frame one"))
+	stat, _ := os.Stat(filePath)
+
+	monitor := NewFileMonitor(filePath, cache, time.Millisecond*10, WithWatchMode(WatchPoll))
+	monitor.Start()
+	defer monitor.Stop()
+	time.Sleep(time.Millisecond * 50)
+
+	// Rewritten in place within the same mtime tick at the same size, as on
+	// a FAT or NFS mount
+	updatedData := createValidJPEG("frame two")
+	os.WriteFile(filePath, updatedData, 0644)
+	os.Chtimes(filePath, stat.ModTime(), stat.ModTime())
+	time.Sleep(time.Millisecond * 100)
+
+	frame, ok := cache.Latest()
+	if !ok || frame.Seq != 2 || string(frame.Data) != string(updatedData) {
+		t.Errorf("Expected the rewrite as frame 2, got %+v", frame)
+	}
+}
+
+func TestFileMonitorHybridMode(t *testing.T) {
+	cache := cache.NewImageCache()
+	filePath := createTempFile(t, createValidJPEG("initial content"))
+
+	monitor := NewFileMonitor(filePath, cache, time.Millisecond*10, WithWatchMode(WatchHybrid))
+	monitor.Start()
+	defer monitor.Stop()
+
+	if monitor.Mode() != WatchHybrid || monitor.watcher == nil {
+		t.Fatal("Hybrid mode should use an inotify watcher")
+	}
+
+	updatedData := createValidJPEG("updated content")
+	if err := os.WriteFile(filePath, updatedData, 0644); err != nil {
+		t.Fatalf("Failed to update file: %v", err)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+
+	data, _, _, _ := cache.Get()
+	if string(data) != string(updatedData) {
+		t.Errorf("Hybrid mode should pick up file changes, got %q", string(data))
+	}
+}
+
+func TestFileMonitorFallsBackToPolling(t *testing.T) {
+	cache := cache.NewImageCache()
+	dir := filepath.Join(t.TempDir(), "not-yet-created")
+	filePath := filepath.Join(dir, "test.jpg")
+
+	// Watching a missing directory fails, which must not be fatal
+	monitor := NewFileMonitor(filePath, cache, time.Millisecond*10)
+	monitor.Start()
+	defer monitor.Stop()
+
+	if monitor.Mode() != WatchPoll {
+		t.Fatalf("Expected fallback to poll mode, got %s", monitor.Mode())
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	testData := createValidJPEG("late file")
+	if err := os.WriteFile(filePath, testData, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+
+	data, _, _, ok := cache.Get()
+	if !ok || string(data) != string(testData) {
+		t.Error("Fallback polling should pick up the file once it appears")
+	}
+}
+
+func TestFileMonitorRetriesIncompleteWrite(t *testing.T) {
+	cache := cache.NewImageCache()
+	goodData := createValidJPEG("good frame")
+	filePath := createTempFile(t, goodData)
+
+	monitor := NewFileMonitor(filePath, cache, time.Millisecond*10)
+	monitor.Start()
+	defer monitor.Stop()
+
+	time.Sleep(time.Millisecond * 50)
+
+	// Simulate a producer that writes the frame in two steps
+	newData := createValidJPEG("second frame written slowly")
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	file.Write(newData[:10])
+	time.Sleep(time.Millisecond * 10)
+	file.Write(newData[10:])
+	file.Close()
+
+	time.Sleep(time.Millisecond * 150)
+
+	data, _, _, _ := cache.Get()
+	if string(data) != string(newData) {
+		t.Errorf("Expected complete frame after retry, got %q", string(data))
+	}
+	if cache.Rejected() != 0 {
+		t.Errorf("Frame completed within retry window should not be rejected, got %d rejections", cache.Rejected())
+	}
+}
+
+func TestFileMonitorKeepsLastGoodFrame(t *testing.T) {
+	cache := cache.NewImageCache()
+	goodData := createValidJPEG("good frame")
+	filePath := createTempFile(t, goodData)
+
+	monitor := NewFileMonitor(filePath, cache, time.Millisecond*10)
+	monitor.Start()
+	defer monitor.Stop()
+
+	time.Sleep(time.Millisecond * 50)
+
+	// A torn frame that never completes
+	if err := os.WriteFile(filePath, goodData[:len(goodData)-2], 0644); err != nil {
+		t.Fatalf("Failed to write torn frame: %v", err)
+	}
+
+	time.Sleep(time.Millisecond * 200)
+
+	data, _, _, _ := cache.Get()
+	if string(data) != string(goodData) {
+		t.Errorf("Cache should keep the last good frame, got %q", string(data))
+	}
+	if cache.Rejected() == 0 {
+		t.Error("Torn frame should be counted as rejected")
+	}
+}
+
+func TestFileMonitorRenameIntoPlace(t *testing.T) {
+	for _, mode := range []WatchMode{WatchFsnotify, WatchPoll} {
+		t.Run(string(mode), func(t *testing.T) {
+			cache := cache.NewImageCache()
+			filePath := createTempFile(t, createValidJPEG("original"))
+
+			monitor := NewFileMonitor(filePath, cache, time.Millisecond*10, WithWatchMode(mode))
+			monitor.Start()
+			defer monitor.Stop()
+
+			time.Sleep(time.Millisecond * 50)
+
+			renamedData := createValidJPEG("renamed into place")
+			tmpPath := filepath.Join(filepath.Dir(filePath), ".test.jpg.tmp")
+			if err := os.WriteFile(tmpPath, renamedData, 0644); err != nil {
+				t.Fatalf("Failed to write temp file: %v", err)
+			}
+			if err := os.Rename(tmpPath, filePath); err != nil {
+				t.Fatalf("Failed to rename file: %v", err)
+			}
+
+			time.Sleep(time.Millisecond * 100)
+
+			data, _, _, _ := cache.Get()
+			if string(data) != string(renamedData) {
+				t.Errorf("Expected renamed frame, got %q", string(data))
+			}
+		})
+	}
+}
+
+func TestFileMonitorDecodeValidation(t *testing.T) {
+	cache := cache.NewImageCache()
+	filePath := createTempFile(t, createValidJPEG("markers only, not decodable"))
+
+	monitor := NewFileMonitor(filePath, cache, time.Millisecond*10, WithValidation(imaging.ValidateDecode))
+	monitor.Start()
+	defer monitor.Stop()
+
+	if cache.HasData() {
+		t.Error("Decode validation should reject data that only has JPEG markers")
+	}
+	if cache.Rejected() != 1 {
+		t.Errorf("Expected 1 rejected frame, got %d", cache.Rejected())
+	}
+}
+
+func TestFileMonitorTranscodesPNG(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 32, 16)))
+
+	cache := cache.NewImageCache()
+	filePath := createTempFile(t, buf.Bytes())
+
+	monitor := NewFileMonitor(filePath, cache, time.Millisecond*10, WithTranscodeQuality(75))
+	monitor.Start()
+	defer monitor.Stop()
+
+	frame, ok := cache.Latest()
+	if !ok {
+		t.Fatal("PNG file should be cached")
+	}
+	data := frame.Data
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Cached frame should be a JPEG: %v", err)
+	}
+	if img.Bounds().Dx() != 32 || img.Bounds().Dy() != 16 {
+		t.Errorf("Unexpected transcoded size %v", img.Bounds())
+	}
+	if frame.Size != int64(len(data)) {
+		t.Errorf("Frame size should be the JPEG size, got %d for %d bytes", frame.Size, len(data))
+	}
+}
+
+func TestFileMonitorReportsRemovedFile(t *testing.T) {
+	for _, mode := range []WatchMode{WatchFsnotify, WatchPoll} {
+		t.Run(string(mode), func(t *testing.T) {
+			cache := cache.NewImageCache()
+			testData := createValidJPEG("about to be removed")
+			filePath := createTempFile(t, testData)
+
+			monitor := NewFileMonitor(filePath, cache, time.Millisecond*10, WithWatchMode(mode))
+			monitor.Start()
+			defer monitor.Stop()
+
+			if state := cache.Status().State; state != "ok" {
+				t.Fatalf("Expected ok state, got %s", state)
+			}
+
+			if err := os.Remove(filePath); err != nil {
+				t.Fatalf("Failed to remove file: %v", err)
+			}
+
+			time.Sleep(time.Millisecond * 100)
+
+			if state := cache.Status().State; state != "missing" {
+				t.Errorf("Expected missing state after removal, got %s", state)
+			}
+
+			if err := os.WriteFile(filePath, createValidJPEG("restored"), 0644); err != nil {
+				t.Fatalf("Failed to restore file: %v", err)
+			}
+
+			time.Sleep(time.Millisecond * 100)
+
+			if state := cache.Status().State; state != "ok" {
+				t.Errorf("Expected ok state after file returns, got %s", state)
+			}
+		})
+	}
+}
+
+func TestFileMonitorSidecar(t *testing.T) {
+	cache := cache.NewImageCacheWithHistory(5, 0)
+	filePath := createTempFile(t, createValidJPEG("frame one"))
+	sidecar := filepath.Join(filepath.Dir(filePath), "test.json")
+	os.WriteFile(sidecar, []byte(`{"faces":[{"x":1}]}`), 0644)
+
+	monitor := NewFileMonitor(filePath, cache, time.Millisecond*10, WithWatchMode(WatchPoll), WithSidecar(sidecar))
+	monitor.Start()
+	defer monitor.Stop()
+
+	frame, ok := cache.Latest()
+	if !ok || string(frame.Metadata) != `{"faces":[{"x":1}]}` {
+		t.Fatalf("Expected the sidecar on the cached frame, got %q", frame.Metadata)
+	}
+
+	// Invalid JSON is not stored
+	os.WriteFile(sidecar, []byte(`{"faces":`), 0644)
+	os.WriteFile(filePath, createValidJPEG("frame two"), 0644)
+	time.Sleep(time.Millisecond * 100)
+
+	if frame, _ := cache.Latest(); frame.Seq != 2 || frame.Metadata != nil {
+		t.Errorf("Expected frame 2 without metadata, got seq %d with %q", frame.Seq, frame.Metadata)
+	}
+
+	// A sidecar written after its frame is attached to it
+	os.WriteFile(sidecar, []byte(`{"faces":[]}`), 0644)
+	time.Sleep(time.Millisecond * 100)
+
+	if frame, _ := cache.Latest(); frame.Seq != 2 || string(frame.Metadata) != `{"faces":[]}` {
+		t.Errorf("Expected the late sidecar on frame 2, got seq %d with %q", frame.Seq, frame.Metadata)
+	}
+
+	// A sidecar far from every frame is not paired
+	os.WriteFile(sidecar, []byte(`{"faces":[{"x":3}]}`), 0644)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(sidecar, old, old)
+	time.Sleep(time.Millisecond * 100)
+
+	if frame, _ := cache.Latest(); string(frame.Metadata) != `{"faces":[]}` {
+		t.Errorf("Expected a stale sidecar to be ignored, got %q", frame.Metadata)
+	}
+
+	// A sidecar written just before the next image waits for it rather than
+	// replacing the detections of the frame before
+	writeAt := func(path string, data []byte, at time.Time) {
+		tmp := path + ".tmp"
+		os.WriteFile(tmp, data, 0644)
+		os.Chtimes(tmp, at, at)
+		os.Rename(tmp, path)
+		time.Sleep(time.Millisecond * 100)
+	}
+	base := time.Now().Add(time.Minute)
+	writeAt(sidecar, []byte(`{"n":3}`), base)
+	writeAt(filePath, createValidJPEG("frame three"), base)
+	writeAt(sidecar, []byte(`{"n":4}`), base.Add(33*time.Millisecond))
+	writeAt(filePath, createValidJPEG("frame four"), base.Add(34*time.Millisecond))
+
+	history := cache.History()
+	if len(history) < 2 {
+		t.Fatalf("Expected at least two frames, got %d", len(history))
+	}
+	previous, latest := history[len(history)-2], history[len(history)-1]
+	if string(previous.Metadata) != `{"n":3}` || string(latest.Metadata) != `{"n":4}` {
+		t.Errorf("Expected each frame to keep its own sidecar, got %q and %q", previous.Metadata, latest.Metadata)
+	}
+}
+
+func TestFileMonitorSidecarSurvivesRewrite(t *testing.T) {
+	cache := cache.NewImageCache()
+	image := createValidJPEG("still scene")
+	filePath := createTempFile(t, image)
+	sidecar := filepath.Join(filepath.Dir(filePath), "test.json")
+	os.WriteFile(sidecar, []byte(`{"faces":[{"x":1}]}`), 0644)
+
+	monitor := NewFileMonitor(filePath, cache, time.Millisecond*10, WithWatchMode(WatchPoll), WithSidecar(sidecar))
+	monitor.Start()
+	defer monitor.Stop()
+
+	// The same bytes written again, too late to pair with the sidecar
+	later := time.Now().Add(time.Second)
+	os.WriteFile(filePath, image, 0644)
+	os.Chtimes(filePath, later, later)
+	time.Sleep(time.Millisecond * 100)
+
+	frame, _ := cache.Latest()
+	if frame.Seq != 1 || string(frame.Metadata) != `{"faces":[{"x":1}]}` {
+		t.Errorf("Expected frame 1 to keep its sidecar, got seq %d with %q", frame.Seq, frame.Metadata)
+	}
+}
+
+func TestFileMonitorSidecarInDirectory(t *testing.T) {
+	cache := cache.NewImageCache()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "frame_001.jpg"), createValidJPEG("frame one"), 0644)
+	sidecar := filepath.Join(dir, "zz.json")
+	os.WriteFile(sidecar, []byte(`{"n":1}`), 0644)
+
+	monitor := NewFileMonitor(dir, cache, time.Millisecond*10, WithWatchMode(WatchPoll), WithSidecar(sidecar))
+	monitor.Start()
+	defer monitor.Stop()
+	time.Sleep(time.Millisecond * 50)
+
+	// The sidecar sorts last but is not served as a frame
+	frame, ok := cache.Latest()
+	if !ok || frame.Seq != 1 || string(frame.Metadata) != `{"n":1}` {
+		t.Errorf("Expected frame 1 with the sidecar, got %+v", frame)
+	}
+	if rejected := cache.Rejected(); rejected != 0 {
+		t.Errorf("Expected the sidecar not to be read as a frame, got %d rejected", rejected)
+	}
+}
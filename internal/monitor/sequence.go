@@ -0,0 +1,175 @@
+package monitor
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bs-frame-monitor/internal/imaging"
+	"github.com/fsnotify/fsnotify"
+)
+
+// SequenceOrder decides which file is newest when a directory or glob of
+// numbered frames is watched.
+type SequenceOrder string
+
+const (
+	// OrderByName treats the lexically greatest file name as newest, which
+	// suits zero-padded names like frame_000123.jpg.
+	OrderByName SequenceOrder = "name"
+	// OrderByModTime treats the most recently modified file as newest.
+	OrderByModTime SequenceOrder = "mtime"
+)
+
+func ParseSequenceOrder(s string) (SequenceOrder, error) {
+	switch order := SequenceOrder(s); order {
+	case OrderByName, OrderByModTime:
+		return order, nil
+	default:
+		return "", fmt.Errorf("unknown sequence order %q (want name or mtime)", s)
+	}
+}
+
+func WithSequenceOrder(order SequenceOrder) Option {
+	return func(fm *FileMonitor) {
+		fm.order = order
+	}
+}
+
+// WithCleanup deletes frames older than the one just cached when watching a
+// directory or glob, so consumed frames don't pile up.
+func WithCleanup(cleanup bool) Option {
+	return func(fm *FileMonitor) {
+		fm.cleanup = cleanup
+	}
+}
+
+// sequencePattern returns the glob to watch for filePath, or "" if it names
+// a single file. Only the final path element may contain glob characters.
+func sequencePattern(filePath string) string {
+	if strings.ContainsAny(filepath.Base(filePath), "*?[") {
+		return filePath
+	}
+	if stat, err := os.Stat(filePath); err == nil && stat.IsDir() {
+		return filepath.Join(filePath, "*")
+	}
+	return ""
+}
+
+// matches reports whether path belongs to the watched sequence. Only image
+// files are frames, so other files in the directory, such as the sidecar or
+// configuration, are never read or cleaned up. Hidden files are skipped
+// because producers commonly write them before renaming.
+func (fm *FileMonitor) matches(path string) bool {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, ".") || path == fm.sidecar || !imaging.HasImageExtension(name) {
+		return false
+	}
+	ok, _ := filepath.Match(fm.pattern, path)
+	return ok
+}
+
+// handleSequenceEvent reads a newly written frame if it is newer than the
+// one being served. Removals are ignored: producers and cleanup delete old
+// frames routinely.
+func (fm *FileMonitor) handleSequenceEvent(event fsnotify.Event) {
+	if !fm.matches(event.Name) || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+		return
+	}
+
+	if event.Name != fm.current && fm.current != "" {
+		switch fm.order {
+		case OrderByName:
+			if filepath.Base(event.Name) < filepath.Base(fm.current) {
+				return
+			}
+		case OrderByModTime:
+			stat, err := os.Stat(event.Name)
+			if err != nil || (fm.lastStat != nil && stat.ModTime().Before(fm.lastStat.ModTime())) {
+				return
+			}
+		}
+	}
+
+	fm.readAndCacheImage(event.Name)
+}
+
+// pollSequence serves the newest matching file if it differs from the one
+// last read. If it does not validate, the newest older file that does is
+// served instead.
+func (fm *FileMonitor) pollSequence() {
+	files := fm.listMatches()
+	if len(files) == 0 {
+		fm.markMissing()
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return fm.newer(files[i], files[j]) })
+
+	// Forget rejected files once they are gone
+	for path := range fm.rejected {
+		if !slices.ContainsFunc(files, func(file sequenceFile) bool { return file.path == path }) {
+			delete(fm.rejected, path)
+		}
+	}
+
+	for _, file := range files {
+		if file.path == fm.current && fm.unchanged(file.stat) {
+			return
+		}
+		// A rejected file is not read again until it changes
+		if last, ok := fm.rejected[file.path]; ok && sameState(file.stat, last) {
+			continue
+		}
+		if fm.readAndCacheImage(file.path) {
+			return
+		}
+	}
+}
+
+type sequenceFile struct {
+	path string
+	stat os.FileInfo
+}
+
+func (fm *FileMonitor) listMatches() []sequenceFile {
+	paths, _ := filepath.Glob(fm.pattern)
+
+	files := make([]sequenceFile, 0, len(paths))
+	for _, path := range paths {
+		if !fm.matches(path) {
+			continue
+		}
+		stat, err := os.Stat(path)
+		if err != nil || !stat.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, sequenceFile{path: path, stat: stat})
+	}
+	return files
+}
+
+// newer reports whether a sorts after b in the configured order.
+func (fm *FileMonitor) newer(a, b sequenceFile) bool {
+	if fm.order == OrderByModTime && !a.stat.ModTime().Equal(b.stat.ModTime()) {
+		return a.stat.ModTime().After(b.stat.ModTime())
+	}
+	return filepath.Base(a.path) > filepath.Base(b.path)
+}
+
+// removeOlderFrames deletes the matching files that sort before the frame
+// just cached.
+func (fm *FileMonitor) removeOlderFrames(path string, stat os.FileInfo) {
+	consumed := sequenceFile{path: path, stat: stat}
+	for _, file := range fm.listMatches() {
+		if file.path == path || fm.newer(file, consumed) {
+			continue
+		}
+		if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove consumed frame %s: %v", file.path, err)
+		}
+	}
+}
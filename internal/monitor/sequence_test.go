@@ -0,0 +1,214 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+)
+
+func writeFrame(t *testing.T, dir string, n int) []byte {
+	t.Helper()
+	data := createValidJPEG(fmt.Sprintf("frame %d", n))
+	path := filepath.Join(dir, fmt.Sprintf("frame_%06d.jpg", n))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write frame %d: %v", n, err)
+	}
+	return data
+}
+
+func TestSequencePattern(t *testing.T) {
+	dir := t.TempDir()
+
+	if pattern := sequencePattern(dir); pattern != filepath.Join(dir, "*") {
+		t.Errorf("Directory should watch all files, got %q", pattern)
+	}
+	if pattern := sequencePattern(filepath.Join(dir, "frame_*.jpg")); pattern != filepath.Join(dir, "frame_*.jpg") {
+		t.Errorf("Glob should be used as-is, got %q", pattern)
+	}
+	if pattern := sequencePattern(filepath.Join(dir, "output.jpg")); pattern != "" {
+		t.Errorf("Plain file should not be a sequence, got %q", pattern)
+	}
+}
+
+func TestFileMonitorDirectorySequence(t *testing.T) {
+	for _, mode := range []WatchMode{WatchFsnotify, WatchPoll} {
+		t.Run(string(mode), func(t *testing.T) {
+			dir := t.TempDir()
+			writeFrame(t, dir, 1)
+			expected := writeFrame(t, dir, 2)
+
+			cache := cache.NewImageCache()
+			monitor := NewFileMonitor(dir, cache, time.Millisecond*10, WithWatchMode(mode))
+			monitor.Start()
+			defer monitor.Stop()
+
+			data, _, _, _ := cache.Get()
+			if string(data) != string(expected) {
+				t.Errorf("Expected newest frame at start, got %q", string(data))
+			}
+
+			expected = writeFrame(t, dir, 3)
+			time.Sleep(time.Millisecond * 100)
+
+			data, _, _, _ = cache.Get()
+			if string(data) != string(expected) {
+				t.Errorf("Expected newly written frame, got %q", string(data))
+			}
+
+			// Hidden temp files are ignored even in directory mode
+			if err := os.WriteFile(filepath.Join(dir, ".frame_000004.jpg.tmp"), []byte("partial"), 0644); err != nil {
+				t.Fatalf("Failed to write temp file: %v", err)
+			}
+			time.Sleep(time.Millisecond * 50)
+
+			if cache.Rejected() != 0 {
+				t.Errorf("Hidden files should be skipped, got %d rejections", cache.Rejected())
+			}
+		})
+	}
+}
+
+func TestFileMonitorGlobIgnoresOlderFrames(t *testing.T) {
+	dir := t.TempDir()
+	expected := writeFrame(t, dir, 10)
+
+	cache := cache.NewImageCache()
+	monitor := NewFileMonitor(filepath.Join(dir, "frame_*.jpg"), cache, time.Millisecond*10)
+	monitor.Start()
+	defer monitor.Stop()
+
+	// An older frame written late and a non-matching file must not replace
+	// the newest frame
+	writeFrame(t, dir, 5)
+	if err := os.WriteFile(filepath.Join(dir, "other.jpg"), createValidJPEG("other"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	data, _, _, _ := cache.Get()
+	if string(data) != string(expected) {
+		t.Errorf("Expected newest frame by name, got %q", string(data))
+	}
+}
+
+func TestFileMonitorSequenceByModTime(t *testing.T) {
+	dir := t.TempDir()
+	writeFrame(t, dir, 2)
+	expected := writeFrame(t, dir, 1)
+
+	now := time.Now()
+	os.Chtimes(filepath.Join(dir, "frame_000002.jpg"), now.Add(-time.Minute), now.Add(-time.Minute))
+
+	cache := cache.NewImageCache()
+	monitor := NewFileMonitor(dir, cache, time.Millisecond*10, WithSequenceOrder(OrderByModTime))
+	monitor.Start()
+	defer monitor.Stop()
+
+	data, _, _, _ := cache.Get()
+	if string(data) != string(expected) {
+		t.Errorf("Expected most recently modified frame, got %q", string(data))
+	}
+}
+
+func TestFileMonitorSequenceCleanup(t *testing.T) {
+	dir := t.TempDir()
+	writeFrame(t, dir, 1)
+	writeFrame(t, dir, 2)
+
+	cache := cache.NewImageCache()
+	monitor := NewFileMonitor(dir, cache, time.Millisecond*10, WithCleanup(true))
+	monitor.Start()
+	defer monitor.Stop()
+
+	writeFrame(t, dir, 3)
+	time.Sleep(time.Millisecond * 100)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "frame_000003.jpg" {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("Expected only the newest frame to remain, got %v", names)
+	}
+}
+
+func TestFileMonitorSequenceCleanupKeepsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.ini")
+	os.WriteFile(config, []byte("[player]\n"), 0644)
+	writeFrame(t, dir, 1)
+
+	cache := cache.NewImageCache()
+	monitor := NewFileMonitor(dir, cache, time.Millisecond*10, WithCleanup(true))
+	monitor.Start()
+	defer monitor.Stop()
+
+	writeFrame(t, dir, 2)
+	time.Sleep(time.Millisecond * 100)
+
+	if _, err := os.Stat(config); err != nil {
+		t.Errorf("Cleanup should leave files that are not frames: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "frame_000001.jpg")); !os.IsNotExist(err) {
+		t.Error("Expected the consumed frame to be removed")
+	}
+}
+
+func TestFileMonitorSequenceIgnoresNonImages(t *testing.T) {
+	dir := t.TempDir()
+	data := writeFrame(t, dir, 1)
+	// Sorts after the frame by name
+	os.WriteFile(filepath.Join(dir, "frame_000001.json"), []byte(`{"faces":[]}`), 0644)
+
+	cache := cache.NewImageCache()
+	monitor := NewFileMonitor(dir, cache, time.Millisecond*10, WithWatchMode(WatchPoll))
+	monitor.Start()
+	defer monitor.Stop()
+	time.Sleep(time.Millisecond * 50)
+
+	if frame, ok := cache.Latest(); !ok || string(frame.Data) != string(data) {
+		t.Error("Expected the JPEG to be served")
+	}
+	if rejected := cache.Rejected(); rejected != 0 {
+		t.Errorf("Expected no rejected frames, got %d", rejected)
+	}
+}
+
+func TestFileMonitorSequenceFallsBackToValidFrame(t *testing.T) {
+	dir := t.TempDir()
+	data := writeFrame(t, dir, 1)
+	os.WriteFile(filepath.Join(dir, "frame_000002.jpg"), []byte("not a jpeg"), 0644)
+
+	cache := cache.NewImageCache()
+	monitor := NewFileMonitor(dir, cache, time.Millisecond*10, WithWatchMode(WatchPoll))
+	monitor.Start()
+	defer monitor.Stop()
+	time.Sleep(time.Millisecond * 200)
+
+	if frame, ok := cache.Latest(); !ok || string(frame.Data) != string(data) {
+		t.Error("Expected the newest valid frame to be served")
+	}
+	// The broken frame is rejected once, not on every poll
+	if rejected := cache.Rejected(); rejected != 1 {
+		t.Errorf("Expected 1 rejected frame, got %d", rejected)
+	}
+}
+
+func TestFileMonitorEmptySequenceIsMissing(t *testing.T) {
+	cache := cache.NewImageCache()
+	monitor := NewFileMonitor(filepath.Join(t.TempDir(), "frame_*.jpg"), cache, time.Millisecond*10)
+	monitor.Start()
+	defer monitor.Stop()
+
+	if state := cache.Status().State; state != "missing" {
+		t.Errorf("Expected missing state with no matching frames, got %s", state)
+	}
+}
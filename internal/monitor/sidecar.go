@@ -0,0 +1,157 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// DefaultSidecarMaxSkew is how far apart a sidecar and a frame may be
+	// modified and still be paired.
+	DefaultSidecarMaxSkew = 500 * time.Millisecond
+
+	// maxSidecarSize bounds the sidecar, which is stored with its frame.
+	maxSidecarSize = 1 << 20
+)
+
+// sidecarState is the latest valid version of the sidecar file and the
+// frame it is paired with.
+type sidecarState struct {
+	data    []byte
+	modTime time.Time
+	// seq is the frame the data is attached to, or 0 while it is unpaired,
+	// and skew the difference between their modification times
+	seq  uint64
+	skew time.Duration
+	// pairings holds the skew of the version each retained frame was
+	// stored with, so a later version cannot displace a closer one
+	pairings map[uint64]time.Duration
+
+	// lastStat is the file state last read, valid or not
+	lastStat os.FileInfo
+}
+
+// WithSidecar watches the JSON file at path, such as detection results
+// written next to the image, and stores each version on the cached frame
+// whose modification time is closest to the sidecar's. Versions that are
+// not valid JSON are ignored.
+func WithSidecar(path string) Option {
+	return func(fm *FileMonitor) {
+		if path != "" {
+			// Matched against watcher event names, which are clean
+			path = filepath.Clean(path)
+		}
+		fm.sidecar = path
+	}
+}
+
+// WithSidecarMaxSkew sets how far apart a sidecar and a frame may be
+// modified and still be paired. A sidecar with no frame that close is held
+// until one arrives.
+func WithSidecarMaxSkew(skew time.Duration) Option {
+	return func(fm *FileMonitor) {
+		fm.sidecarMaxSkew = skew
+	}
+}
+
+// loadSidecar reads the sidecar if it changed since it was last read and
+// pairs it with the closest cached frame, unless that frame is already
+// paired with a closer version. A frame read later takes the sidecar over
+// if it is closer still.
+func (fm *FileMonitor) loadSidecar() {
+	stat, err := os.Stat(fm.sidecar)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading sidecar %s: %v", fm.sidecar, err)
+		}
+		return
+	}
+	if last := fm.side.lastStat; last != nil && os.SameFile(stat, last) &&
+		stat.ModTime().Equal(last.ModTime()) && stat.Size() == last.Size() {
+		return
+	}
+	fm.side.lastStat = stat
+
+	data, err := readSidecar(fm.sidecar)
+	if err != nil {
+		// A partially written sidecar is expected; its next write event
+		// brings the complete version
+		log.Printf("Ignoring sidecar %s: %v", fm.sidecar, err)
+		return
+	}
+	fm.side.data, fm.side.modTime = data, stat.ModTime()
+	fm.side.seq, fm.side.skew = 0, 0
+
+	if frame, ok := fm.cache.Closest(stat.ModTime()); ok {
+		// A sidecar written before its image would otherwise replace the
+		// previous frame's detections; it waits for the next frame instead
+		skew, ok := fm.sidecarSkew(frame.ModTime)
+		if prev, paired := fm.side.pairings[frame.Seq]; ok && (!paired || skew < prev) && fm.cache.SetMetadata(frame.Seq, data) {
+			fm.pairedSidecar(frame.Seq, frame.ModTime)
+		}
+	}
+}
+
+// sidecarFor returns the sidecar to store with a frame modified at modTime,
+// or nil if the current sidecar is too far away or closer to the frame it
+// is already paired with.
+func (fm *FileMonitor) sidecarFor(modTime time.Time) []byte {
+	if fm.side.data == nil {
+		return nil
+	}
+	if skew, ok := fm.sidecarSkew(modTime); ok && (fm.side.seq == 0 || skew < fm.side.skew) {
+		return fm.side.data
+	}
+	return nil
+}
+
+// pairedSidecar records that the sidecar was stored with the frame seq,
+// modified at modTime.
+func (fm *FileMonitor) pairedSidecar(seq uint64, modTime time.Time) {
+	fm.side.seq = seq
+	fm.side.skew, _ = fm.sidecarSkew(modTime)
+
+	if fm.side.pairings == nil {
+		fm.side.pairings = make(map[uint64]time.Duration)
+	}
+	for seq := range fm.side.pairings {
+		if _, ok := fm.cache.FrameBySeq(seq); !ok {
+			delete(fm.side.pairings, seq)
+		}
+	}
+	fm.side.pairings[seq] = fm.side.skew
+}
+
+func (fm *FileMonitor) sidecarSkew(modTime time.Time) (time.Duration, bool) {
+	skew := modTime.Sub(fm.side.modTime)
+	if skew < 0 {
+		skew = -skew
+	}
+	return skew, skew <= fm.sidecarMaxSkew
+}
+
+func readSidecar(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSidecarSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSidecarSize {
+		return nil, fmt.Errorf("larger than %d bytes", maxSidecarSize)
+	}
+	if !json.Valid(data) {
+		return nil, errors.New("not valid JSON")
+	}
+	return data, nil
+}
@@ -0,0 +1,162 @@
+package overlay
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/bs-frame-monitor/internal/imaging"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// quality is the JPEG quality of annotated frames. It is high because a
+// requested transform re-encodes them again.
+const quality = 90
+
+// palette colours boxes by label, so each kind of object keeps its colour
+// from frame to frame.
+var palette = []color.RGBA{
+	{0x2e, 0xcc, 0x71, 0xff},
+	{0xf1, 0xc4, 0x0f, 0xff},
+	{0x34, 0x98, 0xdb, 0xff},
+	{0xe7, 0x4c, 0x3c, 0xff},
+	{0x9b, 0x59, 0xb6, 0xff},
+	{0x1a, 0xbc, 0x9c, 0xff},
+}
+
+var labelText = color.RGBA{0x10, 0x10, 0x10, 0xff}
+
+const maxLabel = 32
+
+// Render draws detections onto a JPEG frame and returns the annotated
+// frame. The frame is turned upright first, which is the orientation the
+// boxes are read in.
+func Render(data []byte, detections []Detection) ([]byte, error) {
+	src, err := imaging.DecodeUpright(data)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(image.Rectangle{Max: src.Bounds().Size()})
+	draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	Draw(img, detections)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, fmt.Errorf("failed to encode frame: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Draw draws each detection's box, its label and confidence, and its gaze
+// direction. Lines and text grow with the frame so they stay legible on
+// large frames.
+func Draw(img *image.RGBA, detections []Detection) {
+	size := img.Bounds().Size()
+	scale := max(1, min(size.X, size.Y)/480)
+	thickness := 2 * scale
+
+	for _, d := range detections {
+		box := d.Box.Pixels(size).Add(img.Bounds().Min)
+		c := palette[colorIndex(d.Label)]
+
+		// The outline is drawn inside the box so it never hides the
+		// object's surroundings
+		fill(img, image.Rect(box.Min.X, box.Min.Y, box.Max.X, box.Min.Y+thickness), c)
+		fill(img, image.Rect(box.Min.X, box.Max.Y-thickness, box.Max.X, box.Max.Y), c)
+		fill(img, image.Rect(box.Min.X, box.Min.Y, box.Min.X+thickness, box.Max.Y), c)
+		fill(img, image.Rect(box.Max.X-thickness, box.Min.Y, box.Max.X, box.Max.Y), c)
+
+		if d.Gaze != [2]float64{} {
+			drawGaze(img, box, d.Gaze, thickness, c)
+		}
+		if text := caption(d); text != "" {
+			drawCaption(img, box, text, scale, c)
+		}
+	}
+}
+
+// caption is the text shown above a box, such as "face 93%". Long labels
+// are cut short.
+func caption(d Detection) string {
+	text := d.Label
+	if label := []rune(text); len(label) > maxLabel {
+		text = string(label[:maxLabel-3]) + "..."
+	}
+	if d.Confidence >= 0 {
+		if text != "" {
+			text += " "
+		}
+		text += strconv.Itoa(int(math.Round(d.Confidence*100))) + "%"
+	}
+	return text
+}
+
+func colorIndex(label string) int {
+	h := fnv.New32a()
+	h.Write([]byte(label))
+	return int(h.Sum32() % uint32(len(palette)))
+}
+
+func fill(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// drawCaption draws text on a filled label above the box, or just inside
+// its top edge when the box touches the top of the frame. Like the slate,
+// the 7x13 bitmap font is scaled up with nearest-neighbour sampling.
+func drawCaption(img *image.RGBA, box image.Rectangle, text string, scale int, c color.RGBA) {
+	face := basicfont.Face7x13
+	const pad = 2
+	small := image.NewRGBA(image.Rect(0, 0, utf8.RuneCountInString(text)*face.Advance+2*pad, face.Height+2*pad))
+	draw.Draw(small, small.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	d := &font.Drawer{
+		Dst:  small,
+		Src:  image.NewUniform(labelText),
+		Face: face,
+		Dot:  fixed.P(pad, pad+face.Ascent),
+	}
+	d.DrawString(text)
+
+	w, h := small.Bounds().Dx()*scale, small.Bounds().Dy()*scale
+	at := image.Pt(box.Min.X, box.Min.Y-h)
+	if at.Y < img.Bounds().Min.Y {
+		at.Y = box.Min.Y
+	}
+	dst := image.Rectangle{Min: at, Max: at.Add(image.Pt(w, h))}
+	draw.NearestNeighbor.Scale(img, dst, small, small.Bounds(), draw.Src, nil)
+}
+
+// drawGaze draws a line from the centre of the box in the gaze direction,
+// as long as the box's larger side, ending in a square marker.
+func drawGaze(img *image.RGBA, box image.Rectangle, gaze [2]float64, thickness int, c color.RGBA) {
+	length := math.Hypot(gaze[0], gaze[1])
+	if length == 0 || math.IsNaN(length) || math.IsInf(length, 0) {
+		return
+	}
+	// Clamped to the frame, so a bogus box cannot make the line endless
+	bounds := img.Bounds().Size()
+	reach := min(float64(max(box.Dx(), box.Dy())), math.Hypot(float64(bounds.X), float64(bounds.Y)))
+	dx, dy := gaze[0]/length, gaze[1]/length
+
+	cx := float64(box.Min.X+box.Max.X) / 2
+	cy := float64(box.Min.Y+box.Max.Y) / 2
+	half := thickness / 2
+	for t := 0.0; t <= reach; t += 0.5 {
+		x, y := int(cx+dx*t), int(cy+dy*t)
+		fill(img, image.Rect(x-half, y-half, x-half+thickness, y-half+thickness), c)
+	}
+
+	x, y := int(cx+dx*reach), int(cy+dy*reach)
+	marker := 2 * thickness
+	fill(img, image.Rect(x-marker, y-marker, x+marker, y+marker), c)
+}
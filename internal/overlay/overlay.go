@@ -0,0 +1,226 @@
+// Package overlay draws detection results, such as the boxes, labels and
+// gaze directions written by a detection extension, onto frames.
+package overlay
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bs-frame-monitor/internal/imaging"
+)
+
+// Fields maps a detection JSON document onto detections. Each field is a
+// dot-separated path of object keys; an empty field is not read.
+type Fields struct {
+	// Detections is the array of detections. Empty means the document
+	// itself is the array.
+	Detections string
+	// Box is each detection's bounding box, an array [x, y, width, height]
+	// or an object with x, y, width and height (or w and h).
+	Box string
+	// Corners reads boxes as [x1, y1, x2, y2], or objects with those keys.
+	Corners bool
+	// Label and Confidence are shown above the box. Confidences above 1
+	// are taken as percentages.
+	Label      string
+	Confidence string
+	// Gaze is a direction [x, y], or an object with x and y, drawn as a line
+	// from the centre of the box. Y points down, as in the image.
+	Gaze string
+}
+
+// DefaultFields reads documents such as
+//
+//	{"detections": [{"box": [120, 80, 64, 64], "label": "face", "confidence": 0.93, "gaze": [0.4, 0.1]}]}
+var DefaultFields = Fields{
+	Detections: "detections",
+	Box:        "box",
+	Label:      "label",
+	Confidence: "confidence",
+	Gaze:       "gaze",
+}
+
+// ParseFields reads a field mapping such as
+// "detections=result.faces,box=bbox,box_format=xyxy,label=name". Fields not
+// named keep their default.
+func ParseFields(spec string) (Fields, error) {
+	fields := DefaultFields
+	if strings.TrimSpace(spec) == "" {
+		return fields, nil
+	}
+	for _, item := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return Fields{}, fmt.Errorf("field mapping %q is not key=value", item)
+		}
+		switch key {
+		case "detections":
+			fields.Detections = value
+		case "box":
+			fields.Box = value
+		case "box_format":
+			switch value {
+			case "xywh":
+				fields.Corners = false
+			case "xyxy":
+				fields.Corners = true
+			default:
+				return Fields{}, fmt.Errorf("box_format must be xywh or xyxy, got %q", value)
+			}
+		case "label":
+			fields.Label = value
+		case "confidence":
+			fields.Confidence = value
+		case "gaze":
+			fields.Gaze = value
+		default:
+			return Fields{}, fmt.Errorf("unknown field %q, expected detections, box, box_format, label, confidence or gaze", key)
+		}
+	}
+	if fields.Box == "" {
+		return Fields{}, fmt.Errorf("the box field cannot be empty")
+	}
+	return fields, nil
+}
+
+// Detection is one detected object.
+type Detection struct {
+	// Box is in pixels of the upright frame. Boxes whose coordinates all
+	// lie between 0 and 1 are read as fractions of the frame.
+	Box   imaging.Rect
+	Label string
+	// Confidence is from 0 to 1, or negative when the detection has none.
+	Confidence float64
+	// Gaze is a direction in image coordinates, zero when there is none.
+	Gaze [2]float64
+}
+
+// Parse reads the detections from a JSON document. Detections without a
+// usable box are skipped; a document without the detections array has
+// none.
+func Parse(data []byte, fields Fields) ([]Detection, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	list, ok := lookup(doc, fields.Detections)
+	if !ok || list == nil {
+		return nil, nil
+	}
+	items, ok := list.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%q is not an array", fields.Detections)
+	}
+
+	detections := make([]Detection, 0, len(items))
+	for _, item := range items {
+		box, ok := lookup(item, fields.Box)
+		if !ok {
+			continue
+		}
+		rect, ok := parseBox(box, fields.Corners)
+		if !ok {
+			continue
+		}
+
+		d := Detection{Box: rect, Confidence: -1}
+		if label, ok := lookup(item, fields.Label); ok {
+			switch label := label.(type) {
+			case string:
+				d.Label = label
+			case float64:
+				d.Label = strconv.FormatFloat(label, 'g', -1, 64)
+			}
+		}
+		if confidence, ok := lookup(item, fields.Confidence); ok {
+			if c, ok := confidence.(float64); ok && c >= 0 {
+				if c > 1 {
+					c /= 100
+				}
+				d.Confidence = min(c, 1)
+			}
+		}
+		if gaze, ok := lookup(item, fields.Gaze); ok {
+			if v, ok := numbers(gaze, "x", "y"); ok {
+				d.Gaze = [2]float64{v[0], v[1]}
+			}
+		}
+		detections = append(detections, d)
+	}
+	return detections, nil
+}
+
+// lookup follows a dot-separated path of object keys. An empty path is the
+// value itself.
+func lookup(value any, path string) (any, bool) {
+	if path == "" {
+		return value, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func parseBox(value any, corners bool) (imaging.Rect, bool) {
+	var v []float64
+	var ok bool
+	if corners {
+		v, ok = numbers(value, "x1", "y1", "x2", "y2")
+		if ok {
+			v[2], v[3] = v[2]-v[0], v[3]-v[1]
+		}
+	} else if v, ok = numbers(value, "x", "y", "width", "height"); !ok {
+		v, ok = numbers(value, "x", "y", "w", "h")
+	}
+	if !ok || v[2] <= 0 || v[3] <= 0 {
+		return imaging.Rect{}, false
+	}
+
+	normalized := true
+	for _, n := range v {
+		if n < 0 || n > 1 {
+			normalized = false
+		}
+	}
+	return imaging.Rect{X: v[0], Y: v[1], W: v[2], H: v[3], Normalized: normalized}, true
+}
+
+// numbers reads an array of len(keys) numbers, or an object holding a number
+// under each key.
+func numbers(value any, keys ...string) ([]float64, bool) {
+	out := make([]float64, len(keys))
+	switch value := value.(type) {
+	case []any:
+		if len(value) != len(keys) {
+			return nil, false
+		}
+		for i, v := range value {
+			n, ok := v.(float64)
+			if !ok {
+				return nil, false
+			}
+			out[i] = n
+		}
+	case map[string]any:
+		for i, key := range keys {
+			n, ok := value[key].(float64)
+			if !ok {
+				return nil, false
+			}
+			out[i] = n
+		}
+	default:
+		return nil, false
+	}
+	return out, true
+}
@@ -0,0 +1,129 @@
+package overlay
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/bs-frame-monitor/internal/imaging"
+)
+
+func TestParseFields(t *testing.T) {
+	fields, err := ParseFields("detections=result.faces, box=bbox,box_format=xyxy,label=name,gaze=")
+	if err != nil {
+		t.Fatalf("Failed to parse fields: %v", err)
+	}
+	expected := Fields{Detections: "result.faces", Box: "bbox", Corners: true, Label: "name", Confidence: "confidence"}
+	if fields != expected {
+		t.Errorf("Expected %+v, got %+v", expected, fields)
+	}
+
+	if fields, err := ParseFields(""); err != nil || fields != DefaultFields {
+		t.Errorf("Expected the default fields, got %+v (%v)", fields, err)
+	}
+	for _, spec := range []string{"boxes=b", "box", "box=", "box_format=ltrb"} {
+		if _, err := ParseFields(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	doc := `{"detections": [
+		{"box": [10, 20, 30, 40], "label": "face", "confidence": 0.93, "gaze": [1, 0]},
+		{"box": {"x": 0.1, "y": 0.2, "w": 0.3, "h": 0.4}, "label": 7, "confidence": 85},
+		{"box": [1, 2, 3]},
+		{"label": "no box"}
+	]}`
+	detections, err := Parse([]byte(doc), DefaultFields)
+	if err != nil {
+		t.Fatalf("Failed to parse detections: %v", err)
+	}
+	expected := []Detection{
+		{Box: imaging.Rect{X: 10, Y: 20, W: 30, H: 40}, Label: "face", Confidence: 0.93, Gaze: [2]float64{1, 0}},
+		{Box: imaging.Rect{X: 0.1, Y: 0.2, W: 0.3, H: 0.4, Normalized: true}, Label: "7", Confidence: 0.85},
+	}
+	if len(detections) != len(expected) {
+		t.Fatalf("Expected %d detections, got %+v", len(expected), detections)
+	}
+	for i := range expected {
+		if detections[i] != expected[i] {
+			t.Errorf("Detection %d: expected %+v, got %+v", i, expected[i], detections[i])
+		}
+	}
+
+	// A custom mapping reading corners from a nested array at the root
+	fields := Fields{Box: "bbox", Corners: true, Label: "class.name"}
+	detections, err = Parse([]byte(`[{"bbox": [10, 20, 40, 60], "class": {"name": "person"}}]`), fields)
+	if err != nil || len(detections) != 1 {
+		t.Fatalf("Expected one detection, got %+v (%v)", detections, err)
+	}
+	if d := detections[0]; d.Box != (imaging.Rect{X: 10, Y: 20, W: 30, H: 40}) || d.Label != "person" || d.Confidence >= 0 {
+		t.Errorf("Unexpected detection %+v", d)
+	}
+
+	if detections, err := Parse([]byte(`{"other": 1}`), DefaultFields); err != nil || len(detections) != 0 {
+		t.Errorf("Expected no detections without the array, got %+v (%v)", detections, err)
+	}
+	if _, err := Parse([]byte(`{"detections": {}}`), DefaultFields); err == nil {
+		t.Error("Expected an error when detections is not an array")
+	}
+}
+
+func TestCaption(t *testing.T) {
+	tests := []struct {
+		detection Detection
+		expected  string
+	}{
+		{Detection{Label: "face", Confidence: 0.934}, "face 93%"},
+		{Detection{Label: "face", Confidence: -1}, "face"},
+		{Detection{Confidence: 1}, "100%"},
+		{Detection{Confidence: -1}, ""},
+		{Detection{Label: "a very long label that keeps on going", Confidence: -1}, "a very long label that keeps ..."},
+	}
+	for _, tt := range tests {
+		if text := caption(tt.detection); text != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, text)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 320, 240)), nil)
+
+	detections := []Detection{{
+		Box:        imaging.Rect{X: 0.25, Y: 0.25, W: 0.5, H: 0.5, Normalized: true},
+		Label:      "face",
+		Confidence: 0.9,
+		Gaze:       [2]float64{0, 1},
+	}}
+	data, err := Render(buf.Bytes(), detections)
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode the annotated frame: %v", err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(320, 240) {
+		t.Fatalf("Expected the frame size to be kept, got %v", size)
+	}
+
+	drawn := func(x, y int) bool {
+		r, g, b, _ := color.RGBAModel.Convert(img.At(x, y)).RGBA()
+		return max(r, g, b)-min(r, g, b) > 0x2000
+	}
+	// The box edge, the label above it and the gaze line below its centre
+	// are coloured; the inside of the box is not
+	for _, p := range []image.Point{{80, 120}, {239, 120}, {160, 60}, {82, 55}, {160, 200}} {
+		if !drawn(p.X, p.Y) {
+			t.Errorf("Expected the overlay at %v", p)
+		}
+	}
+	if drawn(120, 100) {
+		t.Error("Expected the inside of the box to be left clean")
+	}
+}
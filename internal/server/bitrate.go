@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+)
+
+// qualityLadder lists the JPEG qualities the bitrate mode steps between,
+// best first. A few fixed steps let clients with similar targets share
+// variants instead of each encoding at its own quality.
+var qualityLadder = []int{90, 80, 70, 60, 50, 40, 30, 20, 10}
+
+// parseKbps reads the kbps query parameter. Zero means no bitrate target.
+func parseKbps(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	kbps, err := strconv.Atoi(value)
+	if err != nil || kbps <= 0 {
+		return 0, fmt.Errorf("kbps must be a positive integer")
+	}
+	return kbps, nil
+}
+
+// bitrateController keeps one video client under a bandwidth target. It
+// lowers the JPEG quality while frames are larger than the target allows at
+// the client's frame rate, raises it again when there is room, and paces
+// sends so the target holds even at the lowest quality.
+type bitrateController struct {
+	bytesPerSec float64
+	// fps is the client's frame rate limit; without one the budget per
+	// frame follows the rate the source produces frames at
+	fps       float64
+	sourceFPS float64
+	level     int
+
+	lastSeq uint64
+	lastAt  time.Time
+}
+
+func newBitrateController(kbps int, fps float64) *bitrateController {
+	return &bitrateController{bytesPerSec: float64(kbps) * 1000 / 8, fps: fps}
+}
+
+// quality returns the JPEG quality to encode the next frame at.
+func (b *bitrateController) quality() int {
+	return qualityLadder[b.level]
+}
+
+// sent records that frame was written as size bytes at now, adjusts the
+// quality and returns how long to wait before the next frame to stay under
+// the target.
+func (b *bitrateController) sent(frame *cache.Frame, size int, now time.Time) time.Duration {
+	b.observe(frame, now)
+
+	rate := b.fps
+	if rate == 0 {
+		rate = b.sourceFPS
+	}
+	if rate > 0 {
+		budget := b.bytesPerSec / rate
+		switch {
+		case float64(size) > budget && b.level < len(qualityLadder)-1:
+			b.level++
+		case float64(size) < budget/2 && b.level > 0:
+			b.level--
+		}
+	}
+	return time.Duration(float64(size) / b.bytesPerSec * float64(time.Second))
+}
+
+// observe estimates the source frame rate from the sequence numbers of the
+// frames sent, which also counts the frames dropped in between. Slates and
+// keepalive resends carry no new sequence number and are ignored.
+func (b *bitrateController) observe(frame *cache.Frame, now time.Time) {
+	if frame.Seq <= b.lastSeq {
+		return
+	}
+	if b.lastSeq != 0 {
+		if elapsed := now.Sub(b.lastAt).Seconds(); elapsed > 0 {
+			rate := float64(frame.Seq-b.lastSeq) / elapsed
+			if b.sourceFPS == 0 {
+				b.sourceFPS = rate
+			} else {
+				b.sourceFPS = b.sourceFPS*0.8 + rate*0.2
+			}
+		}
+	}
+	b.lastSeq = frame.Seq
+	b.lastAt = now
+}
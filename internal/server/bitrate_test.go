@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+)
+
+func TestParseKbps(t *testing.T) {
+	if kbps, err := parseKbps(""); err != nil || kbps != 0 {
+		t.Errorf("Expected no target for an empty value, got %d (%v)", kbps, err)
+	}
+	if kbps, err := parseKbps("500"); err != nil || kbps != 500 {
+		t.Errorf("Expected 500, got %d (%v)", kbps, err)
+	}
+	for _, value := range []string{"0", "-100", "1.5", "fast"} {
+		if _, err := parseKbps(value); err == nil {
+			t.Errorf("Expected an error for kbps=%s", value)
+		}
+	}
+}
+
+func TestBitrateControllerAdaptsQuality(t *testing.T) {
+	// 80 kbps at 10 fps leaves 1000 bytes per frame
+	b := newBitrateController(80, 10)
+	start := b.quality()
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		b.sent(&cache.Frame{Seq: uint64(i + 1)}, 4000, now)
+	}
+	lowered := b.quality()
+	if lowered >= start {
+		t.Fatalf("Expected quality below %d after oversized frames, got %d", start, lowered)
+	}
+
+	b.sent(&cache.Frame{Seq: 4}, 800, now)
+	if b.quality() != lowered {
+		t.Errorf("Expected quality to hold at %d for frames within budget, got %d", lowered, b.quality())
+	}
+
+	b.sent(&cache.Frame{Seq: 5}, 100, now)
+	if b.quality() <= lowered {
+		t.Errorf("Expected quality above %d after small frames, got %d", lowered, b.quality())
+	}
+}
+
+func TestBitrateControllerFollowsSourceRate(t *testing.T) {
+	// Without a frame rate the budget comes from the source: 80 kbps at
+	// 10 fps leaves 1000 bytes per frame, so 1500 byte frames are too large
+	b := newBitrateController(80, 0)
+	start := b.quality()
+	now := time.Now()
+
+	b.sent(&cache.Frame{Seq: 1}, 1500, now)
+	if b.quality() != start {
+		t.Fatalf("Expected quality to hold until the source rate is known, got %d", b.quality())
+	}
+	b.sent(&cache.Frame{Seq: 11}, 1500, now.Add(time.Second))
+	if b.quality() >= start {
+		t.Errorf("Expected quality below %d at the source's 10 fps, got %d", start, b.quality())
+	}
+}
+
+func TestBitrateControllerPacing(t *testing.T) {
+	b := newBitrateController(80, 0)
+	// 10000 bytes is one second of an 80 kbps budget
+	if pause := b.sent(&cache.Frame{Seq: 1}, 10000, time.Now()); pause != time.Second {
+		t.Errorf("Expected a 1s pause, got %v", pause)
+	}
+}
+
+func TestHandleVideoBitrateMode(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	imageCache.Update(encodeTestFrame(t, 64, 48), time.Now(), 0)
+
+	server := NewServer(8080, imageCache)
+	ts := httptest.NewServer(http.HandlerFunc(server.handleVideo))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?kbps=1000")
+	if err != nil {
+		t.Fatalf("Failed to connect to stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := newStreamReader(resp.Body)
+	body, err := reader.readPart(time.Second)
+	if err != nil {
+		t.Fatalf("Expected a frame: %v", err)
+	}
+	frame, _ := imageCache.Latest()
+	if body == string(frame.Data) {
+		t.Error("Expected the frame to be re-encoded in bitrate mode")
+	}
+
+	req := httptest.NewRequest("GET", "/video?kbps=1000&quality=50", nil)
+	w := httptest.NewRecorder()
+	server.handleVideo(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for kbps with quality, got %d", w.Code)
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/bs-frame-monitor/internal/cache"
+	"github.com/bs-frame-monitor/internal/imaging"
+)
+
+// errFrameSkipped reports that a format could not convert a frame. The
+// stream carries on with the next one.
+var errFrameSkipped = errors.New("frame skipped")
+
+// errFrameHeld reports that a format is not ready for a frame yet, which is
+// expected and not logged.
+var errFrameHeld = errors.New("frame held back")
+
+// videoFormat writes the frames of a /video stream in one container format.
+type videoFormat interface {
+	contentType() string
+	// writeFrame writes one frame and returns the number of bytes written.
+	writeFrame(w io.Writer, frame *cache.Frame) (int, error)
+}
+
+// parseVideoFormat returns the format named by the format query parameter.
+func parseVideoFormat(name string, opts videoOptions) (videoFormat, error) {
+	if opts.meta {
+		if name != "" && name != "multipart" {
+			return nil, errors.New("meta=1 is only available with the multipart format")
+		}
+		return metadataFormat{}, nil
+	}
+
+	switch name {
+	case "", "multipart":
+		// Default to multipart for browser compatibility
+		return multipartFormat{}, nil
+	case "mjpeg":
+		return mjpegFormat{}, nil
+	case "y4m":
+		if opts.kbps != 0 {
+			return nil, errors.New("kbps cannot be used with format=y4m, which is uncompressed")
+		}
+		return &y4mFormat{fps: opts.fps}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, expected multipart, mjpeg or y4m", name)
+}
+
+// multipartFormat is multipart/x-mixed-replace, which browsers show as
+// video in an <img> element.
+type multipartFormat struct{}
+
+func (multipartFormat) contentType() string {
+	return "multipart/x-mixed-replace; boundary=frame"
+}
+
+func (multipartFormat) writeFrame(w io.Writer, frame *cache.Frame) (int, error) {
+	return len(frame.Data), writeMultipartFrame(w, frame)
+}
+
+// metadataFormat is multipart/mixed with two parts per frame: the JPEG,
+// then an application/json part with the frame's metadata, or null when it
+// has none. Both parts carry the frame's X-Frame-Seq.
+type metadataFormat struct{}
+
+func (metadataFormat) contentType() string {
+	return "multipart/mixed; boundary=frame"
+}
+
+func (metadataFormat) writeFrame(w io.Writer, frame *cache.Frame) (int, error) {
+	if err := writeMultipartFrame(w, frame); err != nil {
+		return 0, err
+	}
+
+	metadata := frame.Metadata
+	if metadata == nil {
+		metadata = []byte("null")
+	}
+	_, err := fmt.Fprintf(w, "--frame\r\nContent-Type: application/json\r\nContent-Length: %d\r\nX-Frame-Seq: %d\r\n\r\n%s\r\n",
+		len(metadata), frame.Seq, metadata)
+	return len(frame.Data) + len(metadata), err
+}
+
+// mjpegFormat writes bare back-to-back JPEGs, which ffmpeg's mjpeg demuxer
+// and GStreamer's jpegparse split on their markers.
+type mjpegFormat struct{}
+
+func (mjpegFormat) contentType() string {
+	return "video/x-motion-jpeg"
+}
+
+func (mjpegFormat) writeFrame(w io.Writer, frame *cache.Frame) (int, error) {
+	return w.Write(frame.Data)
+}
+
+// y4mFormat writes decoded frames as YUV4MPEG2 with 4:2:0 chroma. Y4M has
+// a single frame size: that of the source's cached frame when the client
+// connects, or else of the first frame from the source. Frames of another
+// size, such as the slate, are scaled to it. Slates are held back while the
+// source has never had a frame, so the stream still gets the source's size.
+// The header's frame rate is nominal: frames are still sent as they arrive.
+type y4mFormat struct {
+	fps  float64
+	size image.Point
+	// started is set once the header is written
+	started bool
+}
+
+func (*y4mFormat) contentType() string {
+	return "video/x-yuv4mpeg"
+}
+
+func (f *y4mFormat) writeFrame(w io.Writer, frame *cache.Frame) (int, error) {
+	if f.size == (image.Point{}) && frame.Seq == 0 {
+		return 0, errFrameHeld
+	}
+	planes, size, err := imaging.YUV420(frame.Data, f.size)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errFrameSkipped, err)
+	}
+
+	n := 0
+	if !f.started {
+		f.size, f.started = size, true
+		header := fmt.Sprintf("YUV4MPEG2 W%d H%d F%s Ip A1:1 C420jpeg XCOLORRANGE=FULL\n", size.X, size.Y, y4mRate(f.fps))
+		if n, err = io.WriteString(w, header); err != nil {
+			return n, err
+		}
+	}
+
+	m, err := io.WriteString(w, "FRAME\n")
+	n += m
+	if err != nil {
+		return n, err
+	}
+	m, err = w.Write(planes)
+	return n + m, err
+}
+
+// y4mRate writes a frame rate as the ratio Y4M expects, defaulting to 30
+// frames per second.
+func y4mRate(fps float64) string {
+	switch {
+	case fps == 0:
+		return "30:1"
+	case fps == math.Trunc(fps):
+		return strconv.Itoa(int(fps)) + ":1"
+	}
+	return strconv.Itoa(int(math.Round(fps*1000))) + ":1000"
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+)
+
+func TestHandleVideoRawMJPEG(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	imageCache.Update([]byte("first frame"), time.Now(), 11)
+
+	server := NewServer(8080, imageCache)
+	ts := httptest.NewServer(http.HandlerFunc(server.handleVideo))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?format=mjpeg")
+	if err != nil {
+		t.Fatalf("Failed to connect to stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "video/x-motion-jpeg" {
+		t.Errorf("Expected video/x-motion-jpeg, got %q", contentType)
+	}
+
+	// Frames follow each other with no boundaries or headers in between
+	buf := make([]byte, len("first frame"))
+	if _, err := io.ReadFull(resp.Body, buf); err != nil || string(buf) != "first frame" {
+		t.Fatalf("Expected the first frame, got %q (%v)", buf, err)
+	}
+	imageCache.Update([]byte("second frame"), time.Now(), 12)
+	buf = make([]byte, len("second frame"))
+	if _, err := io.ReadFull(resp.Body, buf); err != nil || string(buf) != "second frame" {
+		t.Errorf("Expected the second frame right after the first, got %q (%v)", buf, err)
+	}
+}
+
+func TestHandleVideoY4M(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	imageCache.Update(encodeTestFrame(t, 64, 48), time.Now(), 0)
+
+	server := NewServer(8080, imageCache)
+	ts := httptest.NewServer(http.HandlerFunc(server.handleVideo))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?format=y4m&fps=12.5")
+	if err != nil {
+		t.Fatalf("Failed to connect to stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	header, err := reader.ReadString('\n')
+	if err != nil || header != "YUV4MPEG2 W64 H48 F12500:1000 Ip A1:1 C420jpeg XCOLORRANGE=FULL\n" {
+		t.Fatalf("Unexpected Y4M header %q (%v)", header, err)
+	}
+
+	// A frame larger than the header's size is scaled to fit it
+	imageCache.Update(encodeTestFrame(t, 128, 96), time.Now(), 0)
+	for i := 0; i < 2; i++ {
+		if marker, err := reader.ReadString('\n'); err != nil || marker != "FRAME\n" {
+			t.Fatalf("Expected frame %d marker, got %q (%v)", i, marker, err)
+		}
+		planes := make([]byte, 64*48+2*32*24)
+		if _, err := io.ReadFull(reader, planes); err != nil {
+			t.Fatalf("Failed to read frame %d: %v", i, err)
+		}
+	}
+}
+
+func TestHandleVideoY4MBeforeFirstFrame(t *testing.T) {
+	imageCache := cache.NewImageCache()
+
+	server := NewServer(8080, imageCache)
+	ts := httptest.NewServer(http.HandlerFunc(server.handleVideo))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?format=y4m")
+	if err != nil {
+		t.Fatalf("Failed to connect to stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The slate shown meanwhile must not fix the stream's size
+	time.Sleep(time.Millisecond * 50)
+	imageCache.Update(encodeTestFrame(t, 64, 48), time.Now(), 0)
+
+	reader := bufio.NewReader(resp.Body)
+	header, err := reader.ReadString('\n')
+	if err != nil || header != "YUV4MPEG2 W64 H48 F30:1 Ip A1:1 C420jpeg XCOLORRANGE=FULL\n" {
+		t.Fatalf("Unexpected Y4M header %q (%v)", header, err)
+	}
+}
+
+func TestHandleVideoY4MStaleSource(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	imageCache.Update(encodeTestFrame(t, 64, 48), time.Now(), 0)
+	imageCache.SetStaleThreshold(time.Millisecond * 10)
+	time.Sleep(time.Millisecond * 20)
+
+	server := NewServer(8080, imageCache)
+	ts := httptest.NewServer(http.HandlerFunc(server.handleVideo))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?format=y4m&width=32")
+	if err != nil {
+		t.Fatalf("Failed to connect to stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The slate is sent at the cached frame's transformed size
+	reader := bufio.NewReader(resp.Body)
+	header, err := reader.ReadString('\n')
+	if err != nil || header != "YUV4MPEG2 W32 H24 F30:1 Ip A1:1 C420jpeg XCOLORRANGE=FULL\n" {
+		t.Fatalf("Unexpected Y4M header %q (%v)", header, err)
+	}
+	if frame, err := reader.ReadString('\n'); err != nil || frame != "FRAME\n" {
+		t.Errorf("Expected the slate as the first frame, got %q (%v)", frame, err)
+	}
+}
+
+func TestParseVideoFormat(t *testing.T) {
+	for _, name := range []string{"", "multipart", "mjpeg", "y4m"} {
+		if _, err := parseVideoFormat(name, videoOptions{}); err != nil {
+			t.Errorf("%q: unexpected error %v", name, err)
+		}
+	}
+	if _, err := parseVideoFormat("h264", videoOptions{}); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+	if _, err := parseVideoFormat("y4m", videoOptions{kbps: 500}); err == nil {
+		t.Error("Expected an error for kbps with y4m")
+	}
+}
+
+func TestY4MRate(t *testing.T) {
+	for fps, expected := range map[float64]string{0: "30:1", 25: "25:1", 0.5: "500:1000", 29.97: "29970:1000"} {
+		if rate := y4mRate(fps); rate != expected {
+			t.Errorf("%g fps: expected %s, got %s", fps, expected, rate)
+		}
+	}
+}
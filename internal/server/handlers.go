@@ -2,10 +2,19 @@ package server
 
 import (
 	"embed"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+	"github.com/bs-frame-monitor/internal/imaging"
 )
 
 //go:embed static
@@ -32,119 +41,553 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleImage(w http.ResponseWriter, r *http.Request) {
-	data, etag, modTime, ok := s.cache.Get()
+	st, ok := s.streamFor(w, r)
 	if !ok {
-		http.Error(w, "Image not available", http.StatusNotFound)
+		return
+	}
+
+	transform, err := parseTransform(r.URL.Query(), s.transform)
+	if err != nil {
+		writeParamError(w, err)
+		return
+	}
+	withOverlay, err := parseOverlay(r.URL.Query().Get("overlay"))
+	if err != nil {
+		writeParamError(w, err)
+		return
+	}
+
+	frame, state, err := st.currentFrame()
+	if err != nil {
+		log.Printf("Stream %q has no image to serve: %v", st.name, err)
+		http.Error(w, "Image not available", http.StatusServiceUnavailable)
+		return
+	}
+	if frame, err = st.render(frame, transform, withOverlay, s.overlay); err != nil {
+		if errors.Is(err, imaging.ErrInvalidTransform) {
+			writeParamError(w, err)
+			return
+		}
+		http.Error(w, "Failed to transform image", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "image/jpeg")
-	w.Header().Set("ETag", etag)
-	w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	w.Header().Set("ETag", frame.ETag)
+	w.Header().Set("Last-Modified", frame.ModTime.UTC().Format(http.TimeFormat))
 	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Source-Status", string(state))
 
-	if r.Header.Get("If-None-Match") == etag {
+	if etagMatches(r.Header.Get("If-None-Match"), frame.ETag) {
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	w.Write(data)
+	w.Write(frame.Data)
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag.
+// The header may hold a list of ETags or "*", and uses the weak comparison
+// from RFC 9110, so W/"x" matches "x".
+func etagMatches(header, etag string) bool {
+	if header == "" || etag == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *Server) handleVideo(w http.ResponseWriter, r *http.Request) {
-	format := r.URL.Query().Get("format")
-	
-	switch format {
-	case "mjpeg":
-		s.handleMJPEGStream(w, r)
+	st, ok := s.streamFor(w, r)
+	if !ok {
+		return
+	}
+
+	transform, err := parseTransform(r.URL.Query(), s.transform)
+	if err != nil {
+		writeParamError(w, err)
+		return
+	}
+
+	if err := st.checkTransform(transform); err != nil {
+		writeParamError(w, err)
+		return
+	}
+
+	opts := videoOptions{transform: transform}
+	if opts.fps, err = parseFPS(r.URL.Query().Get("fps")); err != nil {
+		writeParamError(w, err)
+		return
+	}
+	if s.maxFPS > 0 && (opts.fps == 0 || opts.fps > s.maxFPS) {
+		opts.fps = s.maxFPS
+	}
+	if opts.overlay, err = parseOverlay(r.URL.Query().Get("overlay")); err != nil {
+		writeParamError(w, err)
+		return
+	}
+	if opts.kbps, err = parseKbps(r.URL.Query().Get("kbps")); err != nil {
+		writeParamError(w, err)
+		return
+	}
+	if opts.kbps != 0 && r.URL.Query().Has("quality") {
+		writeParamError(w, errors.New("quality cannot be combined with kbps"))
+		return
+	}
+
+	switch meta := r.URL.Query().Get("meta"); meta {
+	case "", "0", "false":
+	case "1", "true":
+		opts.meta = true
 	default:
-		// Default to multipart stream for browser compatibility
-		s.handleMultipartStream(w, r)
+		writeParamError(w, fmt.Errorf("meta must be 1 or 0, got %q", meta))
+		return
+	}
+
+	format, err := parseVideoFormat(r.URL.Query().Get("format"), opts)
+	if err != nil {
+		writeParamError(w, err)
+		return
+	}
+	// A stale source shows only the slate, so y4m takes its size from the
+	// cached frame rather than waiting for the source to resume
+	if y4m, ok := format.(*y4mFormat); ok {
+		if latest, ok := st.cache.Latest(); ok {
+			if out, err := st.render(latest, opts.transform, false, s.overlay); err == nil {
+				y4m.size, _ = imaging.FrameSize(out.Data)
+			}
+		}
+	}
+
+	s.streamVideo(w, r, st, opts, format)
+}
+
+// writeParamError reports an invalid query parameter as a JSON error.
+func writeParamError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// videoOptions holds a video client's query parameters.
+type videoOptions struct {
+	transform imaging.Transform
+	// fps limits the frame rate, zero sends frames as they arrive
+	fps float64
+	// kbps adapts the JPEG quality to a bandwidth target, zero disables it
+	kbps int
+	// meta interleaves each frame's JSON metadata with the frames
+	meta bool
+	// overlay draws the detections in each frame's metadata onto it
+	overlay bool
+}
+
+// parseFPS reads the fps query parameter. Zero means frames are sent as
+// they arrive.
+func parseFPS(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
 	}
+	fps, err := strconv.ParseFloat(value, 64)
+	if err != nil || fps <= 0 || math.IsInf(fps, 0) {
+		return 0, fmt.Errorf("fps must be a positive number")
+	}
+	return fps, nil
 }
 
-func (s *Server) handleMultipartStream(w http.ResponseWriter, r *http.Request) {
-	// Set multipart/x-mixed-replace header for streaming
-	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+// streamVideo sends the stream's frames to a client in the given format
+// until the client goes away.
+func (s *Server) streamVideo(w http.ResponseWriter, r *http.Request, st *stream, opts videoOptions, format videoFormat) {
+	w.Header().Set("Content-Type", format.contentType())
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 
-	log.Printf("Video stream started for client %s", r.RemoteAddr)
+	log.Printf("Video stream %q started for client %s", st.name, r.RemoteAddr)
+
+	// Send the headers straight away; a format may hold back its first frame
+	w.WriteHeader(http.StatusOK)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	// Subscribe before reading the first frame so no update is missed
+	sub := st.cache.Subscribe()
+	defer sub.Close()
+
+	// The keepalive timer resends the current frame when the source is idle
+	var keepalive <-chan time.Time
+	var keepaliveTimer *time.Timer
+	if s.keepalive > 0 {
+		keepaliveTimer = time.NewTimer(s.keepalive)
+		defer keepaliveTimer.Stop()
+		keepalive = keepaliveTimer.C
+	}
 
-	// Stream images at 30 FPS
-	ticker := time.NewTicker(time.Millisecond * 33)
-	defer ticker.Stop()
+	// Slates show the time since the last frame, so refresh them periodically
+	slateTicker := time.NewTicker(time.Second)
+	defer slateTicker.Stop()
+
+	// With a frame rate set, frames arriving before the next send is due are
+	// dropped; the timer then sends whichever frame is current by then
+	var interval time.Duration
+	if opts.fps > 0 {
+		interval = time.Duration(float64(time.Second) / opts.fps)
+	}
+	var bitrate *bitrateController
+	if opts.kbps > 0 {
+		bitrate = newBitrateController(opts.kbps, opts.fps)
+	}
+	var nextSend time.Time
+	var rateTimer *time.Timer
+	var rateC <-chan time.Time
+	defer func() {
+		if rateTimer != nil {
+			rateTimer.Stop()
+		}
+	}()
 
 	frameCount := 0
+	var bytesSent int64
 	startTime := time.Now()
+	var lastSource, lastSent *cache.Frame
+
+	// Skipped frames are logged once for each distinct error, as a crop
+	// that does not fit the source would otherwise log every frame
+	var lastSkip string
+	skipped := func(frame *cache.Frame, err error) {
+		if msg := err.Error(); msg != lastSkip {
+			lastSkip = msg
+			log.Printf("Video stream %q skipped frame %d for client %s: %v", st.name, frame.Seq, r.RemoteAddr, err)
+		}
+	}
+
+	send := func(frame *cache.Frame) bool {
+		n, err := format.writeFrame(w, frame)
+		if errors.Is(err, errFrameHeld) {
+			return true
+		}
+		if errors.Is(err, errFrameSkipped) {
+			skipped(frame, err)
+			return true
+		}
+		if err != nil {
+			log.Printf("Video stream %q write error for client %s (frame %d): %v", st.name, r.RemoteAddr, frameCount, err)
+			return false
+		}
+
+		// Flush to send immediately
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+
+		lastSent = frame
+		lastSkip = ""
+		frameCount++
+		bytesSent += int64(n)
+		pause := interval
+		if bitrate != nil {
+			pause = max(pause, bitrate.sent(frame, n, time.Now()))
+		}
+		if pause > 0 {
+			nextSend = time.Now().Add(pause)
+		}
+		if keepaliveTimer != nil {
+			keepaliveTimer.Reset(s.keepalive)
+		}
+		return true
+	}
 
 	for {
+		// Only send when the frame to show differs from the last one sent.
+		// Frames are immutable and slates are reused until their text
+		// changes, so pointer identity detects this. If the slate cannot be
+		// drawn there is nothing to show until the next frame.
+		frame, _, _ := st.currentFrame()
+		if frame != nil && lastSource != nil && frame.Seq != 0 && frame.Seq == lastSource.Seq && !opts.meta && !opts.overlay {
+			// Metadata attached to a frame already sent; only meta=1 and
+			// overlay clients see it
+			lastSource = frame
+		}
+		if frame != nil && frame != lastSource {
+			if wait := time.Until(nextSend); wait > 0 {
+				if rateC == nil {
+					if rateTimer == nil {
+						rateTimer = time.NewTimer(wait)
+					} else {
+						rateTimer.Reset(wait)
+					}
+					rateC = rateTimer.C
+				}
+			} else {
+				lastSource = frame
+				transform := opts.transform
+				if bitrate != nil {
+					transform.Quality = bitrate.quality()
+				}
+				out, err := st.render(frame, transform, opts.overlay, s.overlay)
+				if err != nil {
+					skipped(frame, err)
+				} else if !send(out) {
+					return
+				}
+			}
+		}
+
 		select {
 		case <-r.Context().Done():
 			// Log why the stream ended
 			duration := time.Since(startTime)
-			log.Printf("Video stream ended for client %s | Duration: %v | Frames sent: %d | Reason: %v",
-				r.RemoteAddr, duration, frameCount, r.Context().Err())
+			limit := "none"
+			if opts.fps > 0 {
+				limit = strconv.FormatFloat(opts.fps, 'g', -1, 64) + " fps"
+			}
+			target := ""
+			if bitrate != nil {
+				target = fmt.Sprintf(" (target %d kbps, quality %d)", opts.kbps, bitrate.quality())
+			}
+			log.Printf("Video stream %q ended for client %s | Duration: %v | Frames sent: %d | Effective FPS: %.2f | Rate limit: %s | Bitrate: %.0f kbps%s | Reason: %v",
+				st.name, r.RemoteAddr, duration, frameCount, float64(frameCount)/duration.Seconds(), limit,
+				float64(bytesSent)*8/1000/duration.Seconds(), target, r.Context().Err())
 			return
-		case <-ticker.C:
-			data, _, _, ok := s.cache.Get()
-			if !ok {
-				// No image data available yet - wait for next tick
+		case <-sub.C:
+		case <-rateC:
+			rateC = nil
+		case <-slateTicker.C:
+		case <-keepalive:
+			if lastSent == nil {
+				keepaliveTimer.Reset(s.keepalive)
 				continue
 			}
-
-			// Write multipart boundary and headers
-			_, err := w.Write([]byte("--frame\r\n"))
-			if err != nil {
-				log.Printf("Video stream write error for client %s (frame %d): %v", r.RemoteAddr, frameCount, err)
+			if !send(lastSent) {
 				return
 			}
+		}
+	}
+}
 
-			_, err = w.Write([]byte(fmt.Sprintf("Content-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(data))))
-			if err != nil {
-				log.Printf("Video stream write error for client %s (frame %d): %v", r.RemoteAddr, frameCount, err)
-				return
-			}
+// writeMultipartFrame writes one part of a multipart stream. Besides the
+// content headers each part describes its frame, so clients can measure
+// latency and spot dropped frames from gaps in X-Frame-Seq. Slates have
+// sequence number 0.
+func writeMultipartFrame(w io.Writer, frame *cache.Frame) error {
+	var header strings.Builder
+	header.WriteString("--frame\r\nContent-Type: image/jpeg\r\n")
+	fmt.Fprintf(&header, "Content-Length: %d\r\n", len(frame.Data))
+	fmt.Fprintf(&header, "X-Frame-Seq: %d\r\n", frame.Seq)
+	fmt.Fprintf(&header, "X-Frame-Timestamp: %s\r\n", frame.ModTime.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(&header, "X-Cache-Timestamp: %s\r\n", frame.CapturedAt.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(&header, "X-Frame-ETag: %s\r\n", frame.ETag)
+	if size, err := imaging.FrameSize(frame.Data); err == nil {
+		fmt.Fprintf(&header, "X-Frame-Width: %d\r\nX-Frame-Height: %d\r\n", size.X, size.Y)
+	}
+	header.WriteString("\r\n")
 
-			// Write image data
-			_, err = w.Write(data)
-			if err != nil {
-				log.Printf("Video stream write error for client %s (frame %d): %v", r.RemoteAddr, frameCount, err)
-				return
-			}
+	if _, err := io.WriteString(w, header.String()); err != nil {
+		return err
+	}
 
-			_, err = w.Write([]byte("\r\n"))
-			if err != nil {
-				log.Printf("Video stream write error for client %s (frame %d): %v", r.RemoteAddr, frameCount, err)
-				return
-			}
+	// Write image data
+	if _, err := w.Write(frame.Data); err != nil {
+		return err
+	}
 
-			// Flush to send immediately
-			if flusher, ok := w.(http.Flusher); ok {
-				flusher.Flush()
-			}
+	_, err := w.Write([]byte("\r\n"))
+	return err
+}
 
-			frameCount++
-		}
+// handleMetadata serves the JSON metadata of the stream's latest frame,
+// such as the detection results read from a sidecar file.
+func (s *Server) handleMetadata(w http.ResponseWriter, r *http.Request) {
+	st, ok := s.streamFor(w, r)
+	if !ok {
+		return
+	}
+
+	frame, ok := st.cache.Latest()
+	if !ok || frame.Metadata == nil {
+		http.Error(w, "Metadata not available", http.StatusNotFound)
+		return
+	}
+
+	etag := "\"" + cache.ContentHash(frame.Metadata) + "\""
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Frame-Seq", strconv.FormatUint(frame.Seq, 10))
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
+	w.Write(frame.Metadata)
+}
+
+type healthResponse struct {
+	Stream         string         `json:"stream"`
+	Status         string         `json:"status"`
+	Timestamp      string         `json:"timestamp"`
+	Source         string         `json:"source,omitempty"`
+	LastFrameAt    *time.Time     `json:"last_frame_at,omitempty"`
+	LastFrameAgeMs *int64         `json:"last_frame_age_ms,omitempty"`
+	FrameSize      int64          `json:"frame_size"`
+	Seq            uint64         `json:"seq"`
+	RejectedFrames uint64         `json:"rejected_frames"`
+	Producers      []producerInfo `json:"producers,omitempty"`
 }
 
-func (s *Server) handleMJPEGStream(w http.ResponseWriter, r *http.Request) {
-	// Use the same multipart format as the main stream for consistency
-	// This provides better ffmpeg compatibility
-	s.handleMultipartStream(w, r)
+type producerInfo struct {
+	ID             string     `json:"id"`
+	Name           string     `json:"name,omitempty"`
+	Connected      bool       `json:"connected"`
+	ConnectedAt    time.Time  `json:"connected_at"`
+	DisconnectedAt *time.Time `json:"disconnected_at,omitempty"`
+	LastFrameAt    *time.Time `json:"last_frame_at,omitempty"`
+	Frames         uint64     `json:"frames"`
+	Rejected       uint64     `json:"rejected_frames"`
+}
+
+func newProducerInfo(p cache.Producer) producerInfo {
+	info := producerInfo{
+		ID:          p.ID,
+		Name:        p.Name,
+		Connected:   p.Connected,
+		ConnectedAt: p.ConnectedAt.UTC(),
+		Frames:      p.Frames,
+		Rejected:    p.Rejected,
+	}
+	if !p.DisconnectedAt.IsZero() {
+		t := p.DisconnectedAt.UTC()
+		info.DisconnectedAt = &t
+	}
+	if !p.LastFrameAt.IsZero() {
+		t := p.LastFrameAt.UTC()
+		info.LastFrameAt = &t
+	}
+	return info
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	st, ok := s.streamFor(w, r)
+	if !ok {
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 
-	status := "ok"
-	if !s.cache.HasData() {
-		status = "no_image"
+	status := st.cache.Status()
+	response := healthResponse{
+		Stream:         st.name,
+		Status:         string(status.State),
+		Timestamp:      time.Now().UTC().Format(time.RFC3339),
+		Source:         status.Source,
+		FrameSize:      status.Size,
+		Seq:            status.Seq,
+		RejectedFrames: status.Rejected,
+	}
+	if !status.LastSeen.IsZero() {
+		lastSeen := status.LastSeen.UTC()
+		ageMs := status.Age.Milliseconds()
+		response.LastFrameAt = &lastSeen
+		response.LastFrameAgeMs = &ageMs
+	}
+	for _, producer := range status.Producers {
+		response.Producers = append(response.Producers, newProducerInfo(producer))
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+type frameInfo struct {
+	Seq        uint64    `json:"seq"`
+	CapturedAt time.Time `json:"captured_at"`
+	ModTime    time.Time `json:"mod_time"`
+	Size       int64     `json:"size"`
+	ETag       string    `json:"etag"`
+	Hash       string    `json:"hash"`
+}
+
+func newFrameInfo(frame *cache.Frame) frameInfo {
+	return frameInfo{
+		Seq:        frame.Seq,
+		CapturedAt: frame.CapturedAt.UTC(),
+		ModTime:    frame.ModTime.UTC(),
+		Size:       frame.Size,
+		ETag:       frame.ETag,
+		Hash:       frame.Hash,
+	}
+}
+
+func (s *Server) handleFrames(w http.ResponseWriter, r *http.Request) {
+	st, ok := s.streamFor(w, r)
+	if !ok {
+		return
+	}
+
+	var frames []*cache.Frame
+	if since := r.URL.Query().Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339Nano, since)
+		if err != nil {
+			http.Error(w, "Invalid since parameter, expected RFC3339 time", http.StatusBadRequest)
+			return
+		}
+		frames = st.cache.FramesSince(t)
+	} else {
+		frames = st.cache.History()
+	}
+
+	infos := make([]frameInfo, 0, len(frames))
+	for _, frame := range frames {
+		infos = append(infos, newFrameInfo(frame))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(map[string]any{"frames": infos})
+}
+
+func (s *Server) handleFrame(w http.ResponseWriter, r *http.Request) {
+	st, ok := s.streamFor(w, r)
+	if !ok {
+		return
+	}
+
+	seq, err := strconv.ParseUint(r.PathValue("seq"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid frame sequence number", http.StatusBadRequest)
+		return
+	}
+
+	frame, ok := st.cache.FrameBySeq(seq)
+	if !ok {
+		http.Error(w, "Frame not available", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("ETag", frame.ETag)
+	w.Header().Set("Last-Modified", frame.ModTime.UTC().Format(http.TimeFormat))
+	w.Header().Set("X-Frame-Seq", strconv.FormatUint(frame.Seq, 10))
+	// Sequence numbers restart with the process, so /frames/5 may name a
+	// different frame later; clients revalidate against the content ETag
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if etagMatches(r.Header.Get("If-None-Match"), frame.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
 
-	w.Write([]byte(`{"status":"` + status + `","timestamp":"` + time.Now().UTC().Format(time.RFC3339) + `"}`))
+	w.Write(frame.Data)
 }
 
 func (s *Server) handleLogo(w http.ResponseWriter, r *http.Request) {
@@ -1,8 +1,15 @@
 package server
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"image/jpeg"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -54,6 +61,7 @@ func TestHandleIndexNotFound(t *testing.T) {
 
 func TestHandleImageNoData(t *testing.T) {
 	cache := cache.NewImageCache()
+	cache.SetSource("/tmp/output.jpg")
 	server := NewServer(8080, cache)
 
 	req := httptest.NewRequest("GET", "/image", nil)
@@ -61,8 +69,83 @@ func TestHandleImageNoData(t *testing.T) {
 
 	server.handleImage(w, req)
 
-	if w.Code != http.StatusNotFound {
-		t.Errorf("Expected status 404, got %d", w.Code)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with slate image, got %d", w.Code)
+	}
+
+	if contentType := w.Header().Get("Content-Type"); contentType != "image/jpeg" {
+		t.Errorf("Expected JPEG slate, got %s", contentType)
+	}
+
+	if status := w.Header().Get("X-Source-Status"); status != "no_image" {
+		t.Errorf("Expected X-Source-Status no_image, got %s", status)
+	}
+
+	if _, err := jpeg.Decode(w.Body); err != nil {
+		t.Errorf("Slate should be a valid JPEG: %v", err)
+	}
+}
+
+func TestHandleImageStaleServesSlate(t *testing.T) {
+	cache := cache.NewImageCache()
+	cache.SetStaleThreshold(time.Millisecond * 10)
+	cache.Update([]byte("old frame"), time.Now(), 9)
+
+	server := NewServer(8080, cache)
+
+	time.Sleep(time.Millisecond * 20)
+
+	req := httptest.NewRequest("GET", "/image", nil)
+	w := httptest.NewRecorder()
+
+	server.handleImage(w, req)
+
+	if w.Body.String() == "old frame" {
+		t.Error("Stale source should serve the slate instead of the last frame")
+	}
+	if status := w.Header().Get("X-Source-Status"); status != "stale" {
+		t.Errorf("Expected X-Source-Status stale, got %s", status)
+	}
+}
+
+func TestHandleImageCustomSlate(t *testing.T) {
+	custom := []byte("custom slate jpeg")
+	server := NewServer(8080, cache.NewImageCache(), WithSlateImage(custom))
+
+	req := httptest.NewRequest("GET", "/image", nil)
+	w := httptest.NewRecorder()
+
+	server.handleImage(w, req)
+
+	if w.Body.String() != string(custom) {
+		t.Errorf("Expected custom slate, got %q", w.Body.String())
+	}
+}
+
+func TestHandleVideoStreamsSlateUntilFirstFrame(t *testing.T) {
+	cache := cache.NewImageCache()
+	server := NewServer(8080, cache, WithSlateImage([]byte("slate")))
+	ts := httptest.NewServer(http.HandlerFunc(server.handleVideo))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect to stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := newStreamReader(resp.Body)
+
+	body, err := reader.readPart(time.Second)
+	if err != nil || body != "slate" {
+		t.Fatalf("Expected slate before first frame, got %q (%v)", body, err)
+	}
+
+	cache.Update([]byte("first frame"), time.Now(), 11)
+
+	body, err = reader.readPart(time.Second)
+	if err != nil || body != "first frame" {
+		t.Errorf("Expected first frame after slate, got %q (%v)", body, err)
 	}
 }
 
@@ -138,6 +221,63 @@ func TestHandleImageNotModified(t *testing.T) {
 	}
 }
 
+func TestHandleImageIfNoneMatchVariants(t *testing.T) {
+	cache := cache.NewImageCache()
+	cache.Update([]byte("fake jpeg data"), time.Now(), 14)
+	etag := cache.GetETag()
+
+	server := NewServer(8080, cache)
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		expected    int
+	}{
+		{"exact", etag, http.StatusNotModified},
+		{"weak", "W/" + etag, http.StatusNotModified},
+		{"list", `"other", ` + etag, http.StatusNotModified},
+		{"wildcard", "*", http.StatusNotModified},
+		{"mismatch", `"other"`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/image", nil)
+			req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			w := httptest.NewRecorder()
+
+			server.handleImage(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandleImageSameSecondSameSizeFrames(t *testing.T) {
+	cache := cache.NewImageCache()
+	modTime := time.Now()
+	cache.Update([]byte("frame-a"), modTime, 7)
+	oldETag := cache.GetETag()
+	cache.Update([]byte("frame-b"), modTime, 7)
+
+	server := NewServer(8080, cache)
+
+	req := httptest.NewRequest("GET", "/image", nil)
+	req.Header.Set("If-None-Match", oldETag)
+	w := httptest.NewRecorder()
+
+	server.handleImage(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for changed frame, got %d", w.Code)
+	}
+	if w.Body.String() != "frame-b" {
+		t.Errorf("Expected new frame data, got %q", w.Body.String())
+	}
+}
+
 func TestHandleHealth(t *testing.T) {
 	cache := cache.NewImageCache()
 	server := NewServer(8080, cache)
@@ -186,3 +326,578 @@ func TestHandleHealthWithImage(t *testing.T) {
 	}
 }
 
+func TestHandleFrames(t *testing.T) {
+	cache := cache.NewImageCacheWithHistory(5, 0)
+	for _, payload := range []string{"one", "two", "three"} {
+		cache.Update([]byte(payload), time.Now(), int64(len(payload)))
+	}
+
+	server := NewServer(8080, cache)
+
+	req := httptest.NewRequest("GET", "/frames", nil)
+	w := httptest.NewRecorder()
+
+	server.handleFrames(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var response struct {
+		Frames []struct {
+			Seq  uint64 `json:"seq"`
+			Size int64  `json:"size"`
+		} `json:"frames"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(response.Frames) != 3 {
+		t.Fatalf("Expected 3 frames, got %d", len(response.Frames))
+	}
+	if response.Frames[2].Seq != 3 || response.Frames[2].Size != 5 {
+		t.Errorf("Unexpected latest frame info: %+v", response.Frames[2])
+	}
+}
+
+func TestHandleFramesSinceInvalid(t *testing.T) {
+	server := NewServer(8080, cache.NewImageCache())
+
+	req := httptest.NewRequest("GET", "/frames?since=yesterday", nil)
+	w := httptest.NewRecorder()
+
+	server.handleFrames(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestHandleFrameBySeq(t *testing.T) {
+	cache := cache.NewImageCacheWithHistory(2, 0)
+	for _, payload := range []string{"one", "two", "three"} {
+		cache.Update([]byte(payload), time.Now(), int64(len(payload)))
+	}
+
+	server := NewServer(8080, cache)
+
+	req := httptest.NewRequest("GET", "/frames/2", nil)
+	req.SetPathValue("seq", "2")
+	w := httptest.NewRecorder()
+
+	server.handleFrame(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if w.Body.String() != "two" {
+		t.Errorf("Expected frame 2 data, got %q", w.Body.String())
+	}
+	if w.Header().Get("X-Frame-Seq") != "2" {
+		t.Errorf("Expected X-Frame-Seq 2, got %s", w.Header().Get("X-Frame-Seq"))
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("Expected frames to be revalidated, got Cache-Control %q", cc)
+	}
+
+	req = httptest.NewRequest("GET", "/frames/2", nil)
+	req.SetPathValue("seq", "2")
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+
+	server.handleFrame(w, req)
+
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected status 304 for a matching ETag, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/frames/1", nil)
+	req.SetPathValue("seq", "1")
+	w = httptest.NewRecorder()
+
+	server.handleFrame(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for evicted frame, got %d", w.Code)
+	}
+}
+
+// streamReader parses multipart stream parts using their Content-Length, so a
+// part can be read as soon as it is sent rather than when the next boundary
+// arrives.
+type streamReader struct {
+	reader  *textproto.Reader
+	pending chan streamPart
+}
+
+type streamPart struct {
+	header textproto.MIMEHeader
+	body   string
+	err    error
+}
+
+func newStreamReader(body io.Reader) *streamReader {
+	return &streamReader{reader: textproto.NewReader(bufio.NewReader(body))}
+}
+
+func (sr *streamReader) next() streamPart {
+	if _, err := sr.reader.ReadLine(); err != nil {
+		return streamPart{err: err}
+	}
+	header, err := sr.reader.ReadMIMEHeader()
+	if err != nil {
+		return streamPart{err: err}
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return streamPart{err: err}
+	}
+	body := make([]byte, length+2)
+	if _, err := io.ReadFull(sr.reader.R, body); err != nil {
+		return streamPart{err: err}
+	}
+	return streamPart{header: header, body: string(body[:length])}
+}
+
+// readPart waits up to timeout for the next part. A part that arrives after a
+// timeout is returned by the following call.
+func (sr *streamReader) readPart(timeout time.Duration) (string, error) {
+	if sr.pending == nil {
+		sr.pending = make(chan streamPart, 1)
+		go func() { sr.pending <- sr.next() }()
+	}
+
+	select {
+	case part := <-sr.pending:
+		sr.pending = nil
+		return part.body, part.err
+	case <-time.After(timeout):
+		return "", errStreamTimeout
+	}
+}
+
+var errStreamTimeout = errors.New("timed out waiting for stream part")
+
+func TestHandleVideoSendsOnlyNewFrames(t *testing.T) {
+	cache := cache.NewImageCache()
+	cache.Update([]byte("first frame"), time.Now(), 11)
+
+	server := NewServer(8080, cache)
+	ts := httptest.NewServer(http.HandlerFunc(server.handleVideo))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect to stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := newStreamReader(resp.Body)
+
+	body, err := reader.readPart(time.Second)
+	if err != nil || body != "first frame" {
+		t.Fatalf("Expected first frame immediately, got %q (%v)", body, err)
+	}
+
+	// With no update the stream should stay quiet rather than resending
+	if _, err := reader.readPart(time.Millisecond * 150); err != errStreamTimeout {
+		t.Fatal("Stream should not resend an unchanged frame")
+	}
+
+	// Nor when only metadata is attached to the frame already sent
+	cache.SetMetadata(1, []byte(`{"faces":1}`))
+	if _, err := reader.readPart(time.Millisecond * 150); err != errStreamTimeout {
+		t.Fatal("Stream should not resend a frame for new metadata")
+	}
+
+	cache.Update([]byte("second frame"), time.Now(), 12)
+
+	body, err = reader.readPart(time.Second)
+	if err != nil || body != "second frame" {
+		t.Errorf("Expected second frame, got %q (%v)", body, err)
+	}
+}
+
+func TestHandleVideoKeepalive(t *testing.T) {
+	cache := cache.NewImageCache()
+	cache.Update([]byte("idle frame"), time.Now(), 10)
+
+	server := NewServer(8080, cache, WithKeepalive(time.Millisecond*50))
+	ts := httptest.NewServer(http.HandlerFunc(server.handleVideo))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect to stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := newStreamReader(resp.Body)
+
+	for i := 0; i < 3; i++ {
+		body, err := reader.readPart(time.Second)
+		if err != nil {
+			t.Fatalf("Expected keepalive frame %d: %v", i, err)
+		}
+		if body != "idle frame" {
+			t.Errorf("Keepalive should resend the current frame, got %q", body)
+		}
+	}
+}
+
+func TestHandleVideoFrameRate(t *testing.T) {
+	tests := []struct {
+		name   string
+		maxFPS float64
+		query  string
+	}{
+		{"requested rate", 0, "?fps=5"},
+		{"server cap", 5, "?fps=100"},
+		{"server cap without request", 5, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := cache.NewImageCache()
+			cache.Update([]byte("frame 1"), time.Now(), 7)
+
+			server := NewServer(8080, cache, WithMaxFPS(tt.maxFPS))
+			ts := httptest.NewServer(http.HandlerFunc(server.handleVideo))
+			defer ts.Close()
+
+			resp, err := http.Get(ts.URL + tt.query)
+			if err != nil {
+				t.Fatalf("Failed to connect to stream: %v", err)
+			}
+			defer resp.Body.Close()
+
+			reader := newStreamReader(resp.Body)
+			if body, err := reader.readPart(time.Second); err != nil || body != "frame 1" {
+				t.Fatalf("Expected first frame immediately, got %q (%v)", body, err)
+			}
+
+			// Frames arriving within the 200ms interval are dropped in favour
+			// of the newest one once the next send is due
+			cache.Update([]byte("frame 2"), time.Now(), 7)
+			cache.Update([]byte("frame 3"), time.Now(), 7)
+
+			if _, err := reader.readPart(time.Millisecond * 100); err != errStreamTimeout {
+				t.Fatal("Stream should wait for the frame interval")
+			}
+			body, err := reader.readPart(time.Second)
+			if err != nil || body != "frame 3" {
+				t.Errorf("Expected newest frame after the interval, got %q (%v)", body, err)
+			}
+		})
+	}
+}
+
+func TestHandleVideoInvalidFPS(t *testing.T) {
+	server := NewServer(8080, cache.NewImageCache())
+
+	for _, fps := range []string{"0", "-1", "fast", "Inf"} {
+		req := httptest.NewRequest("GET", "/video?fps="+fps, nil)
+		w := httptest.NewRecorder()
+
+		server.handleVideo(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("fps=%s: expected status 400, got %d", fps, w.Code)
+		}
+	}
+}
+
+func TestHandleVideoPartHeaders(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	modTime := time.Date(2026, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	imageCache.Update(encodeTestFrame(t, 64, 48), modTime, 0)
+	frame, _ := imageCache.Latest()
+
+	server := NewServer(8080, imageCache)
+	ts := httptest.NewServer(http.HandlerFunc(server.handleVideo))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect to stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	part := newStreamReader(resp.Body).next()
+	if part.err != nil {
+		t.Fatalf("Failed to read part: %v", part.err)
+	}
+
+	expected := map[string]string{
+		"X-Frame-Seq":       "1",
+		"X-Frame-Timestamp": "2026-01-02T03:04:05.123456789Z",
+		"X-Cache-Timestamp": frame.CapturedAt.UTC().Format(time.RFC3339Nano),
+		"X-Frame-Etag":      frame.ETag,
+		"X-Frame-Width":     "64",
+		"X-Frame-Height":    "48",
+	}
+	for name, value := range expected {
+		if got := part.header.Get(name); got != value {
+			t.Errorf("Expected %s %q, got %q", name, value, got)
+		}
+	}
+}
+
+func TestHandleVideoMetadataParts(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	imageCache.UpdateWithMetadata([]byte("first frame"), []byte(`{"faces":1}`), time.Now(), 11)
+
+	server := NewServer(8080, imageCache)
+	ts := httptest.NewServer(http.HandlerFunc(server.handleVideo))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?meta=1")
+	if err != nil {
+		t.Fatalf("Failed to connect to stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "multipart/mixed; boundary=frame" {
+		t.Errorf("Expected a multipart/mixed stream, got %q", contentType)
+	}
+
+	reader := newStreamReader(resp.Body)
+	expected := []struct{ contentType, seq, body string }{
+		{"image/jpeg", "1", "first frame"},
+		{"application/json", "1", `{"faces":1}`},
+		{"image/jpeg", "2", "second frame"},
+		{"application/json", "2", "null"},
+		{"image/jpeg", "2", "second frame"},
+		{"application/json", "2", `{"faces":2}`},
+	}
+	for i, want := range expected {
+		switch i {
+		case 2:
+			imageCache.Update([]byte("second frame"), time.Now(), 12)
+		case 4:
+			// Metadata arriving after its frame is sent again with it
+			imageCache.SetMetadata(2, []byte(`{"faces":2}`))
+		}
+		part := reader.next()
+		if part.err != nil {
+			t.Fatalf("Failed to read part %d: %v", i, part.err)
+		}
+		if part.header.Get("Content-Type") != want.contentType || part.header.Get("X-Frame-Seq") != want.seq || part.body != want.body {
+			t.Errorf("Part %d: expected %s seq %s %q, got %s seq %s %q", i, want.contentType, want.seq, want.body,
+				part.header.Get("Content-Type"), part.header.Get("X-Frame-Seq"), part.body)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/video?meta=1&format=mjpeg", nil)
+	w := httptest.NewRecorder()
+	server.handleVideo(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for meta with mjpeg, got %d", w.Code)
+	}
+}
+
+func TestHandleMetadata(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	server := NewServer(8080, imageCache)
+
+	req := httptest.NewRequest("GET", "/metadata", nil)
+	w := httptest.NewRecorder()
+	server.handleMetadata(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without metadata, got %d", w.Code)
+	}
+
+	imageCache.UpdateWithMetadata([]byte("frame"), []byte(`{"faces":1}`), time.Now(), 5)
+
+	w = httptest.NewRecorder()
+	server.handleMetadata(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != `{"faces":1}` {
+		t.Fatalf("Expected the latest metadata, got %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != "application/json" || w.Header().Get("X-Frame-Seq") != "1" {
+		t.Errorf("Unexpected headers %v", w.Header())
+	}
+
+	req = httptest.NewRequest("GET", "/metadata", nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	server.handleMetadata(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected status 304 for unchanged metadata, got %d", w.Code)
+	}
+}
+
+func TestHandleHealthReportsStaleness(t *testing.T) {
+	cache := cache.NewImageCache()
+	cache.SetSource("/tmp/output.jpg")
+	cache.SetStaleThreshold(time.Millisecond * 20)
+	cache.Update([]byte("test image"), time.Now(), 10)
+
+	server := NewServer(8080, cache)
+
+	time.Sleep(time.Millisecond * 40)
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	w := httptest.NewRecorder()
+
+	server.handleHealth(w, req)
+
+	var response struct {
+		Status         string `json:"status"`
+		Source         string `json:"source"`
+		LastFrameAgeMs int64  `json:"last_frame_age_ms"`
+		FrameSize      int64  `json:"frame_size"`
+		Seq            uint64 `json:"seq"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode health response: %v", err)
+	}
+
+	if response.Status != "stale" {
+		t.Errorf("Expected stale status, got %s", response.Status)
+	}
+	if response.Source != "/tmp/output.jpg" || response.FrameSize != 10 || response.Seq != 1 {
+		t.Errorf("Unexpected health details: %+v", response)
+	}
+	if response.LastFrameAgeMs < 20 {
+		t.Errorf("Expected last frame age of at least 20ms, got %d", response.LastFrameAgeMs)
+	}
+}
+
+func TestHandleHealthReportsMissing(t *testing.T) {
+	cache := cache.NewImageCache()
+	cache.Update([]byte("test image"), time.Now(), 10)
+	cache.MarkMissing()
+
+	server := NewServer(8080, cache)
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	w := httptest.NewRecorder()
+
+	server.handleHealth(w, req)
+
+	if !strings.Contains(w.Body.String(), `"status":"missing"`) {
+		t.Errorf("Health should report missing source, got %s", w.Body.String())
+	}
+}
+
+func TestHandleHealthReportsProducers(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	imageCache.SetProducer(cache.Producer{ID: "name:gaze", Name: "gaze", Connected: true, ConnectedAt: time.Now(), Frames: 42})
+
+	server := NewServer(8080, imageCache)
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	w := httptest.NewRecorder()
+
+	server.handleHealth(w, req)
+
+	var response struct {
+		Producers []struct {
+			Name      string `json:"name"`
+			Connected bool   `json:"connected"`
+			Frames    uint64 `json:"frames"`
+		} `json:"producers"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Producers) != 1 || response.Producers[0].Name != "gaze" ||
+		!response.Producers[0].Connected || response.Producers[0].Frames != 42 {
+		t.Errorf("Unexpected producers in health: %s", w.Body.String())
+	}
+}
+
+func TestNamedStreams(t *testing.T) {
+	defaultCache := cache.NewImageCache()
+	defaultCache.Update([]byte("default frame"), time.Now(), 13)
+	gazeCache := cache.NewImageCache()
+	gazeCache.SetSource("/tmp/gaze.jpg")
+	gazeCache.Update([]byte("gaze frame"), time.Now(), 10)
+
+	server := NewServer(8080, defaultCache, WithStream("gaze", gazeCache))
+
+	tests := []struct {
+		name     string
+		stream   string
+		expected string
+	}{
+		{"top-level alias", "", "default frame"},
+		{"default by name", "default", "default frame"},
+		{"named stream", "gaze", "gaze frame"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/image", nil)
+			if tt.stream != "" {
+				req.SetPathValue("name", tt.stream)
+			}
+			w := httptest.NewRecorder()
+
+			server.handleImage(w, req)
+
+			if w.Body.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, w.Body.String())
+			}
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/streams/pose/image", nil)
+	req.SetPathValue("name", "pose")
+	w := httptest.NewRecorder()
+
+	server.handleImage(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown stream, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/streams/gaze/health", nil)
+	req.SetPathValue("name", "gaze")
+	w = httptest.NewRecorder()
+
+	server.handleHealth(w, req)
+
+	if body := w.Body.String(); !strings.Contains(body, `"stream":"gaze"`) || !strings.Contains(body, `"source":"/tmp/gaze.jpg"`) {
+		t.Errorf("Stream health should describe the gaze stream, got %s", body)
+	}
+}
+
+func TestHandleStreams(t *testing.T) {
+	server := NewServer(8080, cache.NewImageCache(),
+		WithStream("gaze", cache.NewImageCache()),
+		WithStream("pose", cache.NewImageCache()))
+
+	req := httptest.NewRequest("GET", "/streams", nil)
+	w := httptest.NewRecorder()
+
+	server.handleStreams(w, req)
+
+	var response struct {
+		Default string `json:"default"`
+		Streams []struct {
+			Name  string `json:"name"`
+			Video string `json:"video"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Default != "default" {
+		t.Errorf("Expected default stream name, got %q", response.Default)
+	}
+
+	var names []string
+	for _, stream := range response.Streams {
+		names = append(names, stream.Name)
+	}
+	if strings.Join(names, ",") != "default,gaze,pose" {
+		t.Errorf("Expected streams in configuration order, got %v", names)
+	}
+	if response.Streams[1].Video != "/streams/gaze/video" {
+		t.Errorf("Unexpected video URL %q", response.Streams[1].Video)
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bs-frame-monitor/internal/ingest"
+)
+
+type ingestResponse struct {
+	Stream   string `json:"stream"`
+	Accepted int    `json:"accepted"`
+	Rejected int    `json:"rejected"`
+	Seq      uint64 `json:"seq"`
+	Error    string `json:"error,omitempty"`
+}
+
+// authorizeIngest reports whether the request carries the ingest token as a
+// bearer token. It is not accepted in the URL, where it would end up in
+// access logs and shell history.
+func (s *Server) authorizeIngest(r *http.Request) bool {
+	if s.ingestToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.ingestToken)) == 1
+}
+
+// handleIngest accepts frames pushed by a producer. The body is either a
+// single JPEG or a multipart upload with one JPEG per part, which may stay
+// open for as long as the producer keeps sending.
+func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeIngest(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ingest"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	st, ok := s.streamFor(w, r)
+	if !ok {
+		return
+	}
+
+	var mediaType string
+	params := map[string]string{}
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var err error
+		if mediaType, params, err = mime.ParseMediaType(contentType); err != nil {
+			http.Error(w, "Invalid Content-Type", http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		if params["boundary"] == "" {
+			http.Error(w, "Multipart upload without boundary", http.StatusBadRequest)
+			return
+		}
+		s.ingestMultipart(w, r, st, params["boundary"])
+	case mediaType == "", mediaType == "application/octet-stream", strings.HasPrefix(mediaType, "image/"):
+		// The format is sniffed from the data, so any image type is accepted
+		s.ingestSingle(w, r, st)
+	default:
+		http.Error(w, "Unsupported Content-Type, expected an image or multipart", http.StatusUnsupportedMediaType)
+	}
+}
+
+func (s *Server) ingestSingle(w http.ResponseWriter, r *http.Request, st *stream) {
+	response := ingestResponse{Stream: st.name}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(s.maxFrameSize)))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if !errors.As(err, &tooLarge) {
+			http.Error(w, "Failed to read frame", http.StatusBadRequest)
+			return
+		}
+		st.cache.RecordRejected()
+		response.Rejected = 1
+		response.Error = ingest.ErrFrameTooLarge.Error()
+		writeIngestResponse(w, http.StatusRequestEntityTooLarge, response)
+		return
+	}
+
+	if err := ingest.Publish(st.cache, s.input, data, time.Now()); err != nil {
+		response.Rejected = 1
+		response.Error = err.Error()
+		writeIngestResponse(w, http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	response.Accepted = 1
+	response.Seq = st.cache.Status().Seq
+	writeIngestResponse(w, http.StatusOK, response)
+}
+
+func (s *Server) ingestMultipart(w http.ResponseWriter, r *http.Request, st *stream, boundary string) {
+	// Long-lived uploads must outlive the server's read timeout
+	http.NewResponseController(w).SetReadDeadline(time.Time{})
+
+	log.Printf("Ingest upload to stream %q started from %s", st.name, r.RemoteAddr)
+	startTime := time.Now()
+
+	response := ingestResponse{Stream: st.name}
+	reader := multipart.NewReader(r.Body, boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			response.Error = err.Error()
+			break
+		}
+
+		data, err := s.readIngestPart(part)
+		if err == nil {
+			err = ingest.Publish(st.cache, s.input, data, time.Now())
+		} else {
+			st.cache.RecordRejected()
+		}
+		part.Close()
+
+		if err != nil {
+			response.Rejected++
+			log.Printf("Rejected frame pushed to stream %q by %s: %v", st.name, r.RemoteAddr, err)
+			continue
+		}
+		response.Accepted++
+	}
+
+	log.Printf("Ingest upload to stream %q ended from %s | Duration: %v | Frames accepted: %d | Rejected: %d",
+		st.name, r.RemoteAddr, time.Since(startTime), response.Accepted, response.Rejected)
+
+	status := http.StatusOK
+	if response.Error != "" && response.Accepted+response.Rejected == 0 {
+		status = http.StatusBadRequest
+	}
+	response.Seq = st.cache.Status().Seq
+	writeIngestResponse(w, status, response)
+}
+
+// readIngestPart reads one frame from a multipart upload. When the part
+// declares its Content-Length, as ffmpeg's mpjpeg muxer does, the frame is
+// complete as soon as its bytes arrive rather than when the next part starts.
+func (s *Server) readIngestPart(part *multipart.Part) ([]byte, error) {
+	if length := part.Header.Get("Content-Length"); length != "" {
+		n, err := strconv.Atoi(length)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid part Content-Length %q", length)
+		}
+		if n > s.maxFrameSize {
+			return nil, ingest.ErrFrameTooLarge
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(part, data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(part, int64(s.maxFrameSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > s.maxFrameSize {
+		return nil, ingest.ErrFrameTooLarge
+	}
+	return data, nil
+}
+
+func writeIngestResponse(w http.ResponseWriter, status int, response ingestResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
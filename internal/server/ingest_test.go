@@ -0,0 +1,222 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+)
+
+func testJPEG(content string) []byte {
+	return append(append([]byte{0xFF, 0xD8}, content...), 0xFF, 0xD9)
+}
+
+func decodeIngestResponse(t *testing.T, w *httptest.ResponseRecorder) ingestResponse {
+	t.Helper()
+	var response ingestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response %q: %v", w.Body.String(), err)
+	}
+	return response
+}
+
+func TestHandleIngestAuthorization(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		auth     string
+		query    string
+		expected int
+	}{
+		{"disabled without token", "", "Bearer ", "", http.StatusUnauthorized},
+		{"missing token", "secret", "", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer wrong", "", http.StatusUnauthorized},
+		{"bearer token", "secret", "Bearer secret", "", http.StatusOK},
+		{"query token", "secret", "", "?token=secret", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(8080, cache.NewImageCache(), WithIngestToken(tt.token))
+
+			req := httptest.NewRequest("POST", "/ingest"+tt.query, bytes.NewReader(testJPEG("frame")))
+			req.Header.Set("Content-Type", "image/jpeg")
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+
+			server.handleIngest(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandleIngestSingleFrame(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	server := NewServer(8080, imageCache, WithIngestToken("secret"), WithMaxFrameSize(64))
+
+	post := func(body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/ingest", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		server.handleIngest(w, req)
+		return w
+	}
+
+	frame := testJPEG("pushed frame")
+	w := post(frame)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if response := decodeIngestResponse(t, w); response.Accepted != 1 || response.Seq != 1 {
+		t.Errorf("Unexpected response %+v", response)
+	}
+	if data, _, _, _ := imageCache.Get(); !bytes.Equal(data, frame) {
+		t.Error("Pushed frame should be cached")
+	}
+
+	if w := post([]byte("not a jpeg")); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for invalid frame, got %d", w.Code)
+	}
+	if w := post(testJPEG(strings.Repeat("x", 100))); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for oversized frame, got %d", w.Code)
+	}
+
+	if imageCache.Rejected() != 2 {
+		t.Errorf("Expected 2 rejected frames, got %d", imageCache.Rejected())
+	}
+	if data, _, _, _ := imageCache.Get(); !bytes.Equal(data, frame) {
+		t.Error("Rejected frames should not replace the last good frame")
+	}
+}
+
+func TestHandleIngestTranscodesPNG(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	server := NewServer(8080, imageCache, WithIngestToken("secret"), WithTranscodeQuality(60))
+
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)))
+
+	req := httptest.NewRequest("POST", "/ingest", &buf)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "image/png")
+	w := httptest.NewRecorder()
+
+	server.handleIngest(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	data, _, _, _ := imageCache.Get()
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("Pushed PNG should be cached as a JPEG: %v", err)
+	}
+}
+
+func TestHandleIngestUnsupportedContentType(t *testing.T) {
+	server := NewServer(8080, cache.NewImageCache(), WithIngestToken("secret"))
+
+	req := httptest.NewRequest("POST", "/ingest", strings.NewReader("{}"))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	server.handleIngest(w, req)
+
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415, got %d", w.Code)
+	}
+}
+
+func TestHandleIngestMultipart(t *testing.T) {
+	gazeCache := cache.NewImageCache()
+	server := NewServer(8080, cache.NewImageCache(),
+		WithStream("gaze", gazeCache), WithIngestToken("secret"), WithMaxFrameSize(64))
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range [][]byte{testJPEG("one"), []byte("corrupt"), testJPEG(strings.Repeat("x", 100)), testJPEG("two")} {
+		pw, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"image/jpeg"}})
+		pw.Write(part)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/streams/gaze/ingest", &body)
+	req.SetPathValue("name", "gaze")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "multipart/x-mixed-replace; boundary="+mw.Boundary())
+	w := httptest.NewRecorder()
+
+	server.handleIngest(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	response := decodeIngestResponse(t, w)
+	if response.Stream != "gaze" || response.Accepted != 2 || response.Rejected != 2 {
+		t.Errorf("Unexpected response %+v", response)
+	}
+	if data, _, _, _ := gazeCache.Get(); !bytes.Equal(data, testJPEG("two")) {
+		t.Errorf("Expected last pushed frame in the gaze stream, got %q", data)
+	}
+}
+
+func TestHandleIngestMultipartIsLive(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	server := NewServer(8080, imageCache, WithIngestToken("secret"))
+
+	pr, pw := io.Pipe()
+	req := httptest.NewRequest("POST", "/ingest", pr)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "multipart/x-mixed-replace;boundary=ffmpeg")
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		server.handleIngest(w, req)
+		close(done)
+	}()
+
+	// Parts as written by ffmpeg's mpjpeg muxer
+	for _, content := range []string{"first", "second"} {
+		frame := testJPEG(content)
+		fmt.Fprintf(pw, "--ffmpeg\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(frame))
+		pw.Write(frame)
+		pw.Write([]byte("\r\n"))
+
+		deadline := time.Now().Add(time.Second)
+		for {
+			if data, _, _, _ := imageCache.Get(); bytes.Equal(data, frame) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Frame %q should be cached before the next part starts", content)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	pw.Write([]byte("--ffmpeg--\r\n"))
+	pw.Close()
+	<-done
+
+	if response := decodeIngestResponse(t, w); response.Accepted != 2 {
+		t.Errorf("Expected 2 accepted frames, got %+v", response)
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/bs-frame-monitor/internal/cache"
+	"github.com/bs-frame-monitor/internal/overlay"
+)
+
+// parseOverlay reads the overlay query parameter.
+func parseOverlay(value string) (bool, error) {
+	switch value {
+	case "", "none":
+		return false, nil
+	case "detections":
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown overlay %q, expected detections or none", value)
+}
+
+// overlayCache shares the annotated version of a stream's latest frame
+// between all clients asking for the detections overlay, so each frame is
+// drawn once. Annotated frames then go through the variant cache like any
+// other frame.
+type overlayCache struct {
+	mu      sync.Mutex
+	latest  *annotated
+	lastErr string
+}
+
+type annotated struct {
+	source *cache.Frame
+	done   chan struct{}
+	frame  *cache.Frame
+}
+
+func newOverlayCache() *overlayCache {
+	return &overlayCache{}
+}
+
+// get returns src with its detections drawn on it. Slates, frames without
+// metadata and frames whose detections cannot be read or drawn are returned
+// as they are.
+func (oc *overlayCache) get(src *cache.Frame, fields overlay.Fields) *cache.Frame {
+	if src.Seq == 0 || src.Metadata == nil {
+		return src
+	}
+
+	oc.mu.Lock()
+	if a := oc.latest; a != nil && a.source == src {
+		oc.mu.Unlock()
+		<-a.done
+		return a.frame
+	}
+	a := &annotated{source: src, done: make(chan struct{})}
+	// A client lagging behind on an older frame must not displace a newer one
+	if oc.latest == nil || oc.latest.source.Seq <= src.Seq {
+		oc.latest = a
+	}
+	oc.mu.Unlock()
+
+	a.frame = oc.draw(src, fields)
+	close(a.done)
+	return a.frame
+}
+
+func (oc *overlayCache) draw(src *cache.Frame, fields overlay.Fields) *cache.Frame {
+	detections, err := overlay.Parse(src.Metadata, fields)
+	if err == nil {
+		var data []byte
+		if data, err = overlay.Render(src.Data, detections); err == nil {
+			hash := cache.ContentHash(data)
+			return &cache.Frame{
+				Seq:        src.Seq,
+				Data:       data,
+				ETag:       "\"" + hash + "\"",
+				Hash:       hash,
+				ModTime:    src.ModTime,
+				CapturedAt: src.CapturedAt,
+				Size:       int64(len(data)),
+				Metadata:   src.Metadata,
+			}
+		}
+	}
+	oc.logError(src, err)
+	return src
+}
+
+// logError logs why a frame was served without its overlay, once for each
+// distinct error so a misconfigured field mapping does not flood the log.
+func (oc *overlayCache) logError(src *cache.Frame, err error) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	if msg := err.Error(); msg != oc.lastErr {
+		oc.lastErr = msg
+		log.Printf("Serving frame %d without its overlay: %v", src.Seq, err)
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+	"github.com/bs-frame-monitor/internal/imaging"
+	"github.com/bs-frame-monitor/internal/overlay"
+)
+
+func TestParseOverlay(t *testing.T) {
+	for value, expected := range map[string]bool{"": false, "none": false, "detections": true} {
+		if on, err := parseOverlay(value); err != nil || on != expected {
+			t.Errorf("%q: expected %v, got %v (%v)", value, expected, on, err)
+		}
+	}
+	if _, err := parseOverlay("boxes"); err == nil {
+		t.Error("Expected an error for an unknown overlay")
+	}
+}
+
+func TestHandleImageOverlay(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	clean := encodeTestFrame(t, 64, 48)
+	imageCache.UpdateWithMetadata(clean, []byte(`{"faces": [{"bbox": [8, 8, 32, 24], "name": "face"}]}`), time.Now(), 0)
+	server := NewServer(8080, imageCache, WithOverlayFields(overlay.Fields{Detections: "faces", Box: "bbox", Label: "name"}))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/image?"+query, nil)
+		w := httptest.NewRecorder()
+		server.handleImage(w, req)
+		return w
+	}
+
+	if w := get(""); !bytes.Equal(w.Body.Bytes(), clean) {
+		t.Error("Expected the clean frame without the overlay parameter")
+	}
+
+	w := get("overlay=detections")
+	if w.Code != http.StatusOK || bytes.Equal(w.Body.Bytes(), clean) {
+		t.Fatalf("Expected an annotated frame, got status %d", w.Code)
+	}
+	if again := get("overlay=detections"); again.Header().Get("ETag") != w.Header().Get("ETag") {
+		t.Error("Repeated overlay requests should return the same ETag")
+	}
+
+	w = get("overlay=detections&width=32")
+	img, err := jpeg.Decode(w.Body)
+	if err != nil || img.Bounds().Size() != image.Pt(32, 24) {
+		t.Errorf("Expected the overlay to combine with a resize, got %v", err)
+	}
+
+	if w := get("overlay=boxes"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown overlay, got %d", w.Code)
+	}
+
+	// Frames without detections are served as they are
+	imageCache.Update(clean, time.Now(), 0)
+	if w := get("overlay=detections"); !bytes.Equal(w.Body.Bytes(), clean) {
+		t.Error("Expected the clean frame when there are no detections")
+	}
+}
+
+func TestOverlayVariantsAreShared(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	imageCache.UpdateWithMetadata(encodeTestFrame(t, 64, 48), []byte(`{"detections": [{"box": [8, 8, 32, 24]}]}`), time.Now(), 0)
+	st := newStream(DefaultStreamName, imageCache)
+	frame, _ := imageCache.Latest()
+	transform := imaging.Transform{Width: 32}
+
+	clean, err := st.render(frame, transform, false, overlay.DefaultFields)
+	if err != nil {
+		t.Fatalf("Failed to render the clean frame: %v", err)
+	}
+	annotated, err := st.render(frame, transform, true, overlay.DefaultFields)
+	if err != nil || annotated.Hash == clean.Hash {
+		t.Fatalf("Expected a distinct annotated frame (%v)", err)
+	}
+
+	// Alternating clients reuse both variants rather than recomputing them
+	if again, _ := st.render(frame, transform, false, overlay.DefaultFields); again != clean {
+		t.Error("Expected the clean variant to be reused after an overlay request")
+	}
+	if again, _ := st.render(frame, transform, true, overlay.DefaultFields); again != annotated {
+		t.Error("Expected the annotated variant to be reused after a clean request")
+	}
+}
+
+func TestHandleVideoOverlayRedrawsLateDetections(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	imageCache.Update(encodeTestFrame(t, 64, 48), time.Now(), 0)
+
+	server := NewServer(8080, imageCache)
+	ts := httptest.NewServer(http.HandlerFunc(server.handleVideo))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?overlay=detections")
+	if err != nil {
+		t.Fatalf("Failed to connect to stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := newStreamReader(resp.Body)
+	first := reader.next()
+	if first.err != nil {
+		t.Fatalf("Failed to read the first frame: %v", first.err)
+	}
+
+	// Detections attached after the frame was sent redraw it
+	imageCache.SetMetadata(1, []byte(`{"detections": [{"box": [8, 8, 32, 24], "label": "face"}]}`))
+	second, err := reader.readPart(time.Second)
+	if err != nil {
+		t.Fatalf("Expected the frame again with its overlay: %v", err)
+	}
+	if second == first.body {
+		t.Error("Expected the resent frame to carry the overlay")
+	}
+}
@@ -7,27 +7,160 @@ import (
 	"time"
 
 	"github.com/bs-frame-monitor/internal/cache"
+	"github.com/bs-frame-monitor/internal/imaging"
+	"github.com/bs-frame-monitor/internal/ingest"
+	"github.com/bs-frame-monitor/internal/overlay"
 )
 
 type Server struct {
-	port       int
-	cache      *cache.ImageCache
-	httpServer *http.Server
+	port          int
+	streams       map[string]*stream
+	streamOrder   []string
+	defaultStream string
+	keepalive     time.Duration
+	maxFPS        float64
+	transform     imaging.Transform
+	overlay       overlay.Fields
+	slateImage    []byte
+	ingestToken   string
+	maxFrameSize  int
+	input         imaging.Input
+	httpServer    *http.Server
 }
 
-func NewServer(port int, cache *cache.ImageCache) *Server {
-	return &Server{
-		port:  port,
-		cache: cache,
+type Option func(*Server)
+
+// WithKeepalive makes video streams resend the current frame when no new
+// frame has arrived within interval, so idle clients and proxies don't time
+// out. Zero disables keepalive resends.
+func WithKeepalive(interval time.Duration) Option {
+	return func(s *Server) {
+		s.keepalive = interval
+	}
+}
+
+// WithMaxFPS caps the frame rate of every video stream, including clients
+// that ask for a higher rate. Zero leaves streams uncapped.
+func WithMaxFPS(fps float64) Option {
+	return func(s *Server) {
+		s.maxFPS = fps
+	}
+}
+
+// WithDefaultTransform applies t to every stream's /image and /video
+// responses. Query parameters on a request replace the matching parts of it.
+func WithDefaultTransform(t imaging.Transform) Option {
+	return func(s *Server) {
+		s.transform = t
+	}
+}
+
+// WithOverlayFields sets how the detection JSON stored with frames is read
+// for ?overlay=detections. The default is overlay.DefaultFields.
+func WithOverlayFields(fields overlay.Fields) Option {
+	return func(s *Server) {
+		s.overlay = fields
+	}
+}
+
+// WithSlateImage serves the given JPEG instead of the generated "waiting for
+// source" slate when no usable frame is available.
+func WithSlateImage(data []byte) Option {
+	return func(s *Server) {
+		s.slateImage = data
+	}
+}
+
+// WithIngestToken enables the /ingest endpoints, which accept frames pushed
+// by producers that present token. Ingest is disabled without a token.
+func WithIngestToken(token string) Option {
+	return func(s *Server) {
+		s.ingestToken = token
+	}
+}
+
+// WithMaxFrameSize bounds the size of a single pushed frame in bytes.
+func WithMaxFrameSize(n int) Option {
+	return func(s *Server) {
+		s.maxFrameSize = n
 	}
 }
 
+// WithValidation sets how pushed frames are checked before they are cached.
+func WithValidation(level imaging.ValidationLevel) Option {
+	return func(s *Server) {
+		s.input.Validation = level
+	}
+}
+
+// WithTranscodeQuality sets the JPEG quality used for pushed frames that
+// arrive as PNG, GIF, BMP, TIFF or WebP.
+func WithTranscodeQuality(quality int) Option {
+	return func(s *Server) {
+		s.input.TranscodeQuality = quality
+	}
+}
+
+// WithStream serves an additional named stream under /streams/{name}. The
+// name must satisfy ValidStreamName.
+func WithStream(name string, cache *cache.ImageCache) Option {
+	return func(s *Server) {
+		s.addStream(name, cache)
+	}
+}
+
+// NewServer creates a server whose default stream, served at the top-level
+// endpoints and as /streams/default, is backed by cache.
+func NewServer(port int, cache *cache.ImageCache, opts ...Option) *Server {
+	s := &Server{
+		port:          port,
+		streams:       make(map[string]*stream),
+		defaultStream: DefaultStreamName,
+		maxFrameSize:  ingest.DefaultMaxFrameSize,
+		input:         imaging.DefaultInput,
+		overlay:       overlay.DefaultFields,
+	}
+	s.addStream(DefaultStreamName, cache)
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.slateImage != nil {
+		for _, st := range s.streams {
+			st.slate.setCustom(s.slateImage)
+		}
+	}
+	return s
+}
+
+func (s *Server) addStream(name string, cache *cache.ImageCache) {
+	if _, exists := s.streams[name]; !exists {
+		s.streamOrder = append(s.streamOrder, name)
+	}
+	s.streams[name] = newStream(name, cache)
+}
+
 func (s *Server) Start() error {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/image", s.handleImage)
 	mux.HandleFunc("/video", s.handleVideo)
 	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("GET /metadata", s.handleMetadata)
+	mux.HandleFunc("GET /frames", s.handleFrames)
+	mux.HandleFunc("GET /frames/{seq}", s.handleFrame)
+	mux.HandleFunc("GET /streams", s.handleStreams)
+	mux.HandleFunc("/streams/{name}/image", s.handleImage)
+	mux.HandleFunc("/streams/{name}/video", s.handleVideo)
+	mux.HandleFunc("/streams/{name}/health", s.handleHealth)
+	mux.HandleFunc("GET /streams/{name}/metadata", s.handleMetadata)
+	mux.HandleFunc("GET /streams/{name}/frames", s.handleFrames)
+	mux.HandleFunc("GET /streams/{name}/frames/{seq}", s.handleFrame)
+	if s.ingestToken != "" {
+		mux.HandleFunc("POST /ingest", s.handleIngest)
+		mux.HandleFunc("PUT /ingest", s.handleIngest)
+		mux.HandleFunc("POST /streams/{name}/ingest", s.handleIngest)
+		mux.HandleFunc("PUT /streams/{name}/ingest", s.handleIngest)
+	}
 	mux.HandleFunc("/images/brightsign-logo.svg", s.handleLogo)
 	mux.Handle("/images/", http.StripPrefix("/images/", http.FileServer(http.Dir("images"))))
 	mux.HandleFunc("/", s.handleIndex)
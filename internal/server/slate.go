@@ -0,0 +1,161 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// The slate is drawn at half size with the 7x13 bitmap font and scaled up
+// with nearest-neighbour sampling, which keeps the text crisp.
+const (
+	slateWidth      = 640
+	slateHeight     = 360
+	slateScale      = 2
+	slateLineHeight = 18
+)
+
+var (
+	slateBackground = color.RGBA{0x1e, 0x1e, 0x24, 0xff}
+	slateTitle      = color.RGBA{0x9b, 0x59, 0xb6, 0xff}
+	slateText       = color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+)
+
+// slateRenderer produces the "no signal" frame served when the source has no
+// usable image. Rendered slates are reused until their text changes, which
+// happens at most once a second as the last-frame age ticks over.
+type slateRenderer struct {
+	custom *cache.Frame
+
+	mu    sync.Mutex
+	text  string
+	frame *cache.Frame
+}
+
+func newSlateRenderer() *slateRenderer {
+	return &slateRenderer{}
+}
+
+// setCustom replaces the generated slate with a fixed JPEG image.
+func (sr *slateRenderer) setCustom(data []byte) {
+	sr.custom = slateFrame(data)
+}
+
+// render returns the slate for status. If it cannot be drawn the previous
+// slate is reused, and an error is returned only when there is none.
+func (sr *slateRenderer) render(status cache.Status) (*cache.Frame, error) {
+	if sr.custom != nil {
+		return sr.custom, nil
+	}
+
+	lines := slateLines(status)
+	text := strings.Join(lines, "\n")
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if sr.frame != nil && sr.text == text {
+		return sr.frame, nil
+	}
+
+	data, err := drawSlate(lines)
+	if err != nil {
+		if sr.frame != nil {
+			return sr.frame, nil
+		}
+		return nil, err
+	}
+	sr.text = text
+	sr.frame = slateFrame(data)
+	return sr.frame, nil
+}
+
+func slateFrame(data []byte) *cache.Frame {
+	hash := cache.ContentHash(data)
+	return &cache.Frame{
+		Data:       data,
+		ETag:       "\"" + hash + "\"",
+		Hash:       hash,
+		ModTime:    time.Now(),
+		CapturedAt: time.Now(),
+		Size:       int64(len(data)),
+	}
+}
+
+func slateLines(status cache.Status) []string {
+	var reason string
+	switch status.State {
+	case cache.StateMissing:
+		reason = "Source is missing or disconnected"
+	case cache.StateStale:
+		reason = "Source has stopped updating"
+	default:
+		reason = "No frame received yet"
+	}
+
+	lastFrame := "Last frame: never"
+	if !status.LastSeen.IsZero() {
+		lastFrame = "Last frame: " + formatAge(status.Age) + " ago"
+	}
+
+	lines := []string{"WAITING FOR SOURCE", "", reason}
+	if status.Source != "" {
+		lines = append(lines, status.Source)
+	}
+	return append(lines, lastFrame)
+}
+
+func formatAge(age time.Duration) string {
+	age = age.Truncate(time.Second)
+	if age < time.Second {
+		return "<1s"
+	}
+	return age.String()
+}
+
+func drawSlate(lines []string) ([]byte, error) {
+	small := image.NewRGBA(image.Rect(0, 0, slateWidth/slateScale, slateHeight/slateScale))
+	draw.Draw(small, small.Bounds(), image.NewUniform(slateBackground), image.Point{}, draw.Src)
+
+	face := basicfont.Face7x13
+	top := (small.Bounds().Dy() - len(lines)*slateLineHeight) / 2
+	for i, line := range lines {
+		src := slateText
+		if i == 0 {
+			src = slateTitle
+		}
+		d := &font.Drawer{
+			Dst:  small,
+			Src:  image.NewUniform(src),
+			Face: face,
+		}
+		// Long paths are shortened from the left so the file name stays visible
+		maxChars := small.Bounds().Dx()/face.Advance - 2
+		if len(line) > maxChars {
+			line = "..." + line[len(line)-maxChars+3:]
+		}
+		x := (small.Bounds().Dx() - d.MeasureString(line).Ceil()) / 2
+		d.Dot = fixed.P(x, top+(i+1)*slateLineHeight-face.Descent)
+		d.DrawString(line)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, slateWidth, slateHeight))
+	draw.NearestNeighbor.Scale(img, img.Bounds(), small, small.Bounds(), draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, fmt.Errorf("failed to encode slate: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/bs-frame-monitor/internal/cache"
+	"github.com/bs-frame-monitor/internal/imaging"
+	"github.com/bs-frame-monitor/internal/overlay"
+)
+
+// DefaultStreamName is the name of the stream passed to NewServer, which is
+// also served at the top-level /image, /video and /health endpoints.
+const DefaultStreamName = "default"
+
+var streamNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidStreamName reports whether name can be used in /streams/{name} URLs.
+func ValidStreamName(name string) bool {
+	return streamNamePattern.MatchString(name)
+}
+
+// stream is a named frame source served under /streams/{name}.
+type stream struct {
+	name     string
+	cache    *cache.ImageCache
+	slate    *slateRenderer
+	overlays *overlayCache
+	variants *variantCache
+	// annotatedVariants holds the variants of frames with the overlay
+	// drawn, which share their sequence number with the clean frames
+	annotatedVariants *variantCache
+}
+
+func newStream(name string, cache *cache.ImageCache) *stream {
+	return &stream{
+		name:     name,
+		cache:    cache,
+		slate:    newSlateRenderer(),
+		overlays: newOverlayCache(),
+		variants: newVariantCache(),
+
+		annotatedVariants: newVariantCache(),
+	}
+}
+
+// currentFrame returns the latest frame while the source is healthy, and the
+// slate when there is no frame yet or the source is stale or missing. It
+// fails only if the slate cannot be drawn.
+func (st *stream) currentFrame() (*cache.Frame, cache.SourceState, error) {
+	status := st.cache.Status()
+	if status.State == cache.StateOK {
+		if frame, ok := st.cache.Latest(); ok {
+			return frame, status.State, nil
+		}
+	}
+	frame, err := st.slate.render(status)
+	return frame, status.State, err
+}
+
+// render returns frame as a client asked for it: with the detections
+// overlay drawn if withOverlay is set, then transformed by t. Annotated
+// frames have their own variants, so clean and overlay clients on the same
+// transform do not displace each other's.
+func (st *stream) render(frame *cache.Frame, t imaging.Transform, withOverlay bool, fields overlay.Fields) (*cache.Frame, error) {
+	if withOverlay {
+		if annotated := st.overlays.get(frame, fields); annotated != frame {
+			return st.annotatedVariants.get(annotated, t)
+		}
+	}
+	return st.variants.get(frame, t)
+}
+
+// checkTransform reports whether t can be applied to the stream's latest
+// frame, so a video client asking for a crop outside the frame gets an
+// error up front rather than a stream that never shows anything.
+func (st *stream) checkTransform(t imaging.Transform) error {
+	frame, ok := st.cache.Latest()
+	if !ok || t.Crop.IsZero() {
+		return nil
+	}
+	if err := t.Check(frame.Data); errors.Is(err, imaging.ErrInvalidTransform) {
+		return err
+	}
+	return nil
+}
+
+// streamFor resolves the stream named in the request path, falling back to
+// the default stream for the top-level endpoints. It writes a 404 and
+// returns false for unknown stream names.
+func (s *Server) streamFor(w http.ResponseWriter, r *http.Request) (*stream, bool) {
+	name := r.PathValue("name")
+	if name == "" {
+		name = s.defaultStream
+	}
+
+	st, ok := s.streams[name]
+	if !ok {
+		http.Error(w, "Unknown stream", http.StatusNotFound)
+		return nil, false
+	}
+	return st, true
+}
+
+type streamInfo struct {
+	Name   string `json:"name"`
+	Source string `json:"source,omitempty"`
+	Status string `json:"status"`
+	Seq    uint64 `json:"seq"`
+	Video  string `json:"video"`
+	Image  string `json:"image"`
+	Health string `json:"health"`
+}
+
+func (s *Server) handleStreams(w http.ResponseWriter, r *http.Request) {
+	infos := make([]streamInfo, 0, len(s.streamOrder))
+	for _, name := range s.streamOrder {
+		status := s.streams[name].cache.Status()
+		prefix := "/streams/" + name
+		infos = append(infos, streamInfo{
+			Name:   name,
+			Source: status.Source,
+			Status: string(status.State),
+			Seq:    status.Seq,
+			Video:  prefix + "/video",
+			Image:  prefix + "/image",
+			Health: prefix + "/health",
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(map[string]any{
+		"default": s.defaultStream,
+		"streams": infos,
+	})
+}
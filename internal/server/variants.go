@@ -0,0 +1,232 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+	"github.com/bs-frame-monitor/internal/imaging"
+)
+
+// maxVariants bounds how many transformed frames a stream keeps, one per
+// distinct set of query parameters.
+const maxVariants = 32
+
+// ParseTransform parses a transform written as query parameters, as
+// accepted by /image and /video, such as "rotate=90&width=640".
+func ParseTransform(query string) (imaging.Transform, error) {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return imaging.Transform{}, fmt.Errorf("%w: %v", imaging.ErrInvalidTransform, err)
+	}
+	return parseTransform(values, imaging.Transform{})
+}
+
+// parseTransform reads the transform parameters from a request's query.
+// Parameters in the query replace those of base, the server's default
+// transform; an empty value such as "crop=" clears the default. Width,
+// height and scale replace the default size together.
+func parseTransform(query url.Values, base imaging.Transform) (imaging.Transform, error) {
+	t := base
+	var err error
+
+	parseInt := func(name string) int {
+		value := query.Get(name)
+		if value == "" || err != nil {
+			return 0
+		}
+		n, perr := strconv.Atoi(value)
+		if perr != nil {
+			err = fmt.Errorf("%w: %s must be an integer", imaging.ErrInvalidTransform, name)
+		}
+		return n
+	}
+
+	if query.Has("width") || query.Has("height") || query.Has("scale") {
+		t.Width = parseInt("width")
+		t.Height = parseInt("height")
+		t.Scale = 0
+		if value := query.Get("scale"); value != "" && err == nil {
+			if t.Scale, err = strconv.ParseFloat(value, 64); err != nil {
+				err = fmt.Errorf("%w: scale must be a number", imaging.ErrInvalidTransform)
+			}
+		}
+	}
+	if query.Has("quality") {
+		if t.Quality = parseInt("quality"); t.Quality == 0 && err == nil {
+			err = fmt.Errorf("%w: quality must be between 1 and 100", imaging.ErrInvalidTransform)
+		}
+	}
+	if query.Has("rotate") {
+		t.Rotate = parseInt("rotate")
+	}
+	if query.Has("flip") && err == nil {
+		t.FlipH, t.FlipV, err = parseFlip(query.Get("flip"))
+	}
+	if query.Has("crop") && err == nil {
+		t.Crop = imaging.Rect{}
+		if value := query.Get("crop"); value != "" {
+			t.Crop, err = parseCrop(value)
+		}
+	}
+	if err != nil {
+		return imaging.Transform{}, err
+	}
+	return t, t.Validate()
+}
+
+// parseFlip reads the flip parameter: h, v, hv or none.
+func parseFlip(value string) (h, v bool, err error) {
+	switch value {
+	case "", "none":
+		return false, false, nil
+	case "h":
+		return true, false, nil
+	case "v":
+		return false, true, nil
+	case "hv", "vh":
+		return true, true, nil
+	}
+	return false, false, fmt.Errorf("%w: flip must be h, v or hv", imaging.ErrInvalidTransform)
+}
+
+// parseCrop reads a crop rectangle given as x,y,w,h. Values that are all
+// between 0 and 1 are fractions of the frame, anything else is whole pixels.
+func parseCrop(value string) (imaging.Rect, error) {
+	fields := strings.Split(value, ",")
+	if len(fields) != 4 {
+		return imaging.Rect{}, fmt.Errorf("%w: crop must be x,y,w,h", imaging.ErrInvalidTransform)
+	}
+
+	var v [4]float64
+	normalized := true
+	for i, field := range fields {
+		n, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return imaging.Rect{}, fmt.Errorf("%w: crop must be x,y,w,h with numeric values", imaging.ErrInvalidTransform)
+		}
+		v[i] = n
+		normalized = normalized && n <= 1
+	}
+	if !normalized {
+		for _, n := range v {
+			if n != math.Trunc(n) {
+				return imaging.Rect{}, fmt.Errorf("%w: pixel crop %s must use whole pixels, or fractions of 1 for all four values", imaging.ErrInvalidTransform, value)
+			}
+		}
+	}
+	return imaging.Rect{X: v[0], Y: v[1], W: v[2], H: v[3], Normalized: normalized}, nil
+}
+
+// variantCache shares transformed frames between all clients of a stream.
+// Each transform keeps the variant of the most recent frame it was asked
+// for; concurrent requests for the same frame and transform wait for a
+// single computation.
+type variantCache struct {
+	mu      sync.Mutex
+	entries map[string]*variant
+}
+
+type variant struct {
+	source   *cache.Frame
+	lastUsed time.Time
+	done     chan struct{}
+	frame    *cache.Frame
+	err      error
+}
+
+func newVariantCache() *variantCache {
+	return &variantCache{entries: make(map[string]*variant)}
+}
+
+// get returns src transformed by t, computing it at most once.
+func (vc *variantCache) get(src *cache.Frame, t imaging.Transform) (*cache.Frame, error) {
+	if src.Seq == 0 {
+		// Slates are generated upright and are not cropped, as a region
+		// chosen for the source's frames would cut off their message
+		t.Crop, t.Rotate, t.FlipH, t.FlipV = imaging.Rect{}, 0, false, false
+	}
+	if t.IsZero() {
+		return src, nil
+	}
+	key := t.Key()
+
+	vc.mu.Lock()
+	v, ok := vc.entries[key]
+	if ok && v.source == src {
+		v.lastUsed = time.Now()
+		vc.mu.Unlock()
+		<-v.done
+		return v.frame, v.err
+	}
+	if ok && src.Seq != 0 && v.source.Seq == src.Seq && v.source.Hash == src.Hash {
+		// Only the metadata changed, such as a sidecar arriving after its
+		// frame, so the transformed image is reused
+		vc.mu.Unlock()
+		<-v.done
+		if v.err != nil {
+			return nil, v.err
+		}
+		frame := *v.frame
+		frame.Metadata = src.Metadata
+		done := make(chan struct{})
+		close(done)
+		vc.mu.Lock()
+		if vc.entries[key] == v {
+			vc.entries[key] = &variant{source: src, lastUsed: time.Now(), done: done, frame: &frame}
+		}
+		vc.mu.Unlock()
+		return &frame, nil
+	}
+
+	v = &variant{source: src, lastUsed: time.Now(), done: make(chan struct{})}
+	// A client lagging behind on an older frame must not displace the
+	// variant of a newer one. Slates have no sequence number and always do.
+	if existing := vc.entries[key]; existing == nil || src.Seq == 0 || existing.source.Seq <= src.Seq {
+		vc.entries[key] = v
+		vc.evict()
+	}
+	vc.mu.Unlock()
+
+	v.frame, v.err = transformFrame(src, t, key)
+	close(v.done)
+	return v.frame, v.err
+}
+
+// evict drops the least recently used variants beyond maxVariants. It must
+// be called with vc.mu held.
+func (vc *variantCache) evict() {
+	for len(vc.entries) > maxVariants {
+		var oldestKey string
+		var oldest time.Time
+		for key, v := range vc.entries {
+			if oldestKey == "" || v.lastUsed.Before(oldest) {
+				oldestKey, oldest = key, v.lastUsed
+			}
+		}
+		delete(vc.entries, oldestKey)
+	}
+}
+
+func transformFrame(src *cache.Frame, t imaging.Transform, key string) (*cache.Frame, error) {
+	data, err := t.Apply(src.Data)
+	if err != nil {
+		return nil, err
+	}
+	hash := cache.ContentHash(data)
+	return &cache.Frame{
+		Seq:        src.Seq,
+		Data:       data,
+		ETag:       "\"" + src.Hash + "-" + key + "\"",
+		Hash:       hash,
+		ModTime:    src.ModTime,
+		CapturedAt: src.CapturedAt,
+		Size:       int64(len(data)),
+		Metadata:   src.Metadata,
+	}, nil
+}
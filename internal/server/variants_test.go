@@ -0,0 +1,307 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bs-frame-monitor/internal/cache"
+	"github.com/bs-frame-monitor/internal/imaging"
+)
+
+func encodeTestFrame(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatalf("Failed to encode frame: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseTransform(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected imaging.Transform
+		valid    bool
+	}{
+		{"", imaging.Transform{}, true},
+		{"width=320", imaging.Transform{Width: 320}, true},
+		{"width=320&height=240", imaging.Transform{Width: 320, Height: 240}, true},
+		{"scale=0.5", imaging.Transform{Scale: 0.5}, true},
+		{"width=abc", imaging.Transform{}, false},
+		{"scale=half", imaging.Transform{}, false},
+		{"scale=0.5&width=100", imaging.Transform{}, false},
+		{"height=-5", imaging.Transform{}, false},
+		{"quality=40", imaging.Transform{Quality: 40}, true},
+		{"width=320&quality=40", imaging.Transform{Width: 320, Quality: 40}, true},
+		{"quality=0", imaging.Transform{}, false},
+		{"quality=101", imaging.Transform{}, false},
+		{"crop=10,20,300,200", imaging.Transform{Crop: imaging.Rect{X: 10, Y: 20, W: 300, H: 200}}, true},
+		{"crop=0.25,0.25,0.5,0.5&width=320", imaging.Transform{Width: 320, Crop: imaging.Rect{X: 0.25, Y: 0.25, W: 0.5, H: 0.5, Normalized: true}}, true},
+		{"crop=0,0,1,1", imaging.Transform{Crop: imaging.Rect{W: 1, H: 1, Normalized: true}}, true},
+		{"crop=10,20,300", imaging.Transform{}, false},
+		{"crop=a,b,c,d", imaging.Transform{}, false},
+		{"crop=0.5,0.5,100,100", imaging.Transform{}, false},
+		{"crop=0.5,0.5,0.6,0.2", imaging.Transform{}, false},
+		{"crop=10,10,0,50", imaging.Transform{}, false},
+		{"rotate=90", imaging.Transform{Rotate: 90}, true},
+		{"rotate=270&flip=h", imaging.Transform{Rotate: 270, FlipH: true}, true},
+		{"flip=hv", imaging.Transform{FlipH: true, FlipV: true}, true},
+		{"rotate=45", imaging.Transform{}, false},
+		{"flip=x", imaging.Transform{}, false},
+	}
+
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		transform, err := parseTransform(query, imaging.Transform{})
+		if (err == nil) != tt.valid {
+			t.Errorf("%q: expected valid=%v, got error %v", tt.query, tt.valid, err)
+			continue
+		}
+		if tt.valid && transform != tt.expected {
+			t.Errorf("%q: expected %+v, got %+v", tt.query, tt.expected, transform)
+		}
+	}
+}
+
+func TestParseTransformDefaults(t *testing.T) {
+	base, err := ParseTransform("rotate=90&width=640&crop=0,0,0.5,0.5")
+	if err != nil {
+		t.Fatalf("Failed to parse default transform: %v", err)
+	}
+
+	tests := []struct {
+		query    string
+		expected imaging.Transform
+	}{
+		{"", base},
+		{"rotate=180", imaging.Transform{Rotate: 180, Width: 640, Crop: base.Crop}},
+		{"rotate=0&crop=", imaging.Transform{Width: 640}},
+		{"scale=0.5", imaging.Transform{Rotate: 90, Scale: 0.5, Crop: base.Crop}},
+		{"height=100", imaging.Transform{Rotate: 90, Height: 100, Crop: base.Crop}},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		transform, err := parseTransform(query, base)
+		if err != nil || transform != tt.expected {
+			t.Errorf("%q: expected %+v, got %+v (%v)", tt.query, tt.expected, transform, err)
+		}
+	}
+
+	if _, err := ParseTransform("rotate=91"); err == nil {
+		t.Error("Expected an error for an invalid default transform")
+	}
+}
+
+func TestVariantCacheSharesResults(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	imageCache.Update(encodeTestFrame(t, 64, 48), time.Now(), 0)
+	frame, _ := imageCache.Latest()
+
+	vc := newVariantCache()
+	transform := imaging.Transform{Width: 32}
+
+	// Every concurrent request for the same frame and transform gets the
+	// same computed variant
+	results := make([]*cache.Frame, 8)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = vc.get(frame, transform)
+		}(i)
+	}
+	wg.Wait()
+	for _, result := range results[1:] {
+		if result != results[0] {
+			t.Fatal("Concurrent requests should share one variant")
+		}
+	}
+
+	other, _ := vc.get(frame, imaging.Transform{Width: 16})
+	if other == results[0] {
+		t.Error("Different parameters should produce a different variant")
+	}
+
+	imageCache.Update(encodeTestFrame(t, 64, 32), time.Now(), 0)
+	newer, _ := imageCache.Latest()
+	if variant, _ := vc.get(newer, transform); variant == results[0] || variant.Seq != newer.Seq {
+		t.Error("A new frame should produce a new variant")
+	}
+
+	// A lagging client gets its frame without evicting the newer variant
+	vc.get(frame, transform)
+	if vc.entries[transform.Key()].source != newer {
+		t.Error("An older frame should not replace the variant of a newer one")
+	}
+
+	if original, _ := vc.get(frame, imaging.Transform{}); original != frame {
+		t.Error("The zero transform should return the frame itself")
+	}
+}
+
+func TestVariantCacheEviction(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	imageCache.Update(encodeTestFrame(t, 16, 16), time.Now(), 0)
+	frame, _ := imageCache.Latest()
+
+	vc := newVariantCache()
+	for width := 1; width <= maxVariants+5; width++ {
+		vc.get(frame, imaging.Transform{Width: width})
+	}
+	if len(vc.entries) != maxVariants {
+		t.Errorf("Expected %d variants, got %d", maxVariants, len(vc.entries))
+	}
+}
+
+func TestHandleImageResize(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	imageCache.Update(encodeTestFrame(t, 64, 48), time.Now(), 0)
+	server := NewServer(8080, imageCache)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/image?"+query, nil)
+		w := httptest.NewRecorder()
+		server.handleImage(w, req)
+		return w
+	}
+
+	w := get("width=16")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	img, err := jpeg.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Resized image is not a JPEG: %v", err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(16, 12) {
+		t.Errorf("Expected 16x12 image, got %v", size)
+	}
+
+	original := get("")
+	if w.Header().Get("ETag") == original.Header().Get("ETag") {
+		t.Error("Resized image should have its own ETag")
+	}
+	if again := get("width=16"); again.Header().Get("ETag") != w.Header().Get("ETag") {
+		t.Error("Repeated resize requests should return the same ETag")
+	}
+
+	if w := get("scale=10"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid scale, got %d", w.Code)
+	}
+}
+
+func TestHandleImageCrop(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	imageCache.Update(encodeTestFrame(t, 64, 48), time.Now(), 0)
+	server := NewServer(8080, imageCache)
+
+	req := httptest.NewRequest("GET", "/image?crop=0.5,0.5,0.5,0.5", nil)
+	w := httptest.NewRecorder()
+	server.handleImage(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if size, err := imaging.FrameSize(w.Body.Bytes()); err != nil || size != image.Pt(32, 24) {
+		t.Errorf("Expected a 32x24 crop, got %v (%v)", size, err)
+	}
+
+	// The cropped frame's ETag revalidates
+	req = httptest.NewRequest("GET", "/image?crop=0.5,0.5,0.5,0.5", nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	server.handleImage(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected status 304 for the cropped frame's ETag, got %d", w.Code)
+	}
+
+	for _, target := range []string{"/image?crop=32,0,64,48", "/video?crop=32,0,64,48", "/image?crop=1,2,3"} {
+		req := httptest.NewRequest("GET", target, nil)
+		w := httptest.NewRecorder()
+		if strings.HasPrefix(target, "/video") {
+			server.handleVideo(w, req)
+		} else {
+			server.handleImage(w, req)
+		}
+
+		var body struct{ Error string }
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", target, w.Code)
+		} else if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error == "" {
+			t.Errorf("%s: expected a JSON error, got %q", target, w.Body.String())
+		}
+	}
+}
+
+func TestHandleVideoCropLogsOnce(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	server := NewServer(8080, imageCache)
+	ts := httptest.NewServer(http.HandlerFunc(server.handleVideo))
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	// With no frame yet the crop cannot be checked up front
+	resp, err := http.Get(ts.URL + "?crop=32,0,64,48")
+	if err != nil {
+		t.Fatalf("Failed to connect to stream: %v", err)
+	}
+	frame := encodeTestFrame(t, 64, 48)
+	for i := 0; i < 5; i++ {
+		imageCache.UpdateWithMetadata(frame, []byte(strconv.Itoa(i)), time.Now(), 0)
+		time.Sleep(time.Millisecond * 20)
+	}
+	resp.Body.Close()
+	ts.Close()
+
+	if n := strings.Count(logs.String(), "skipped frame"); n != 1 {
+		t.Errorf("Expected the crop error to be logged once, got %d times", n)
+	}
+}
+
+func TestVariantCacheDoesNotCropSlates(t *testing.T) {
+	vc := newVariantCache()
+	slate := &cache.Frame{Data: encodeTestFrame(t, 64, 48)}
+
+	out, err := vc.get(slate, imaging.Transform{Crop: imaging.Rect{X: 100, Y: 100, W: 10, H: 10}})
+	if err != nil || out != slate {
+		t.Errorf("Expected the slate to be served uncropped, got %v", err)
+	}
+}
+
+func TestHandleImageDefaultTransform(t *testing.T) {
+	imageCache := cache.NewImageCache()
+	imageCache.Update(encodeTestFrame(t, 64, 48), time.Now(), 0)
+	server := NewServer(8080, imageCache, WithDefaultTransform(imaging.Transform{Rotate: 90}))
+
+	for target, expected := range map[string]image.Point{
+		"/image":                     image.Pt(48, 64),
+		"/image?flip=v":              image.Pt(48, 64),
+		"/image?rotate=180":          image.Pt(64, 48),
+		"/image?rotate=0":            image.Pt(64, 48),
+		"/image?rotate=270&width=24": image.Pt(24, 32),
+	} {
+		req := httptest.NewRequest("GET", target, nil)
+		w := httptest.NewRecorder()
+		server.handleImage(w, req)
+
+		size, err := imaging.FrameSize(w.Body.Bytes())
+		if w.Code != http.StatusOK || err != nil || size != expected {
+			t.Errorf("%s: expected a %v frame, got status %d size %v (%v)", target, expected, w.Code, size, err)
+		}
+	}
+}
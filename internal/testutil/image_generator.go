@@ -100,3 +100,11 @@ func ValidateJPEGFormat(data []byte) bool {
 
 	return true
 }
+
+func WrapJPEG(payload []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(jpegHeader)
+	buf.Write(payload)
+	buf.Write(jpegFooter)
+	return buf.Bytes()
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/bs-frame-monitor/internal/cache"
 	"github.com/bs-frame-monitor/internal/monitor"
+	"github.com/bs-frame-monitor/internal/testutil"
 )
 
 func BenchmarkImageCacheGet(b *testing.B) {
@@ -30,6 +31,52 @@ func BenchmarkImageCacheGet(b *testing.B) {
 	})
 }
 
+func BenchmarkImageCacheGetLargeFrame(b *testing.B) {
+	cache := cache.NewImageCache()
+	testData := bytes.Repeat([]byte("jpeg"), 128*1024)
+	modTime := time.Now()
+
+	cache.Update(testData, modTime, int64(len(testData)))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			data, _, _, _ := cache.Get()
+			_ = data[len(data)-1]
+		}
+	})
+}
+
+func BenchmarkImageCacheGetDuringUpdates(b *testing.B) {
+	cache := cache.NewImageCache()
+	testData := bytes.Repeat([]byte("jpeg"), 128*1024)
+	cache.Update(testData, time.Now(), int64(len(testData)))
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(time.Millisecond * 33)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				cache.Update(testData, time.Now(), int64(len(testData)))
+			}
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			cache.Get()
+		}
+	})
+}
+
 func BenchmarkImageCacheUpdate(b *testing.B) {
 	cache := cache.NewImageCache()
 	testData := bytes.Repeat([]byte("test"), 1000)
@@ -46,7 +93,7 @@ func BenchmarkFileMonitorWithFrequentUpdates(b *testing.B) {
 	testFile := filepath.Join(tmpDir, "bench.jpg")
 
 	testData := bytes.Repeat([]byte("benchmark"), 1000)
-	if err := os.WriteFile(testFile, testData, 0644); err != nil {
+	if err := os.WriteFile(testFile, testutil.WrapJPEG(testData), 0644); err != nil {
 		b.Fatalf("Failed to create test file: %v", err)
 	}
 
@@ -59,7 +106,7 @@ func BenchmarkFileMonitorWithFrequentUpdates(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		updatedData := append(testData, byte(i%256))
+		updatedData := testutil.WrapJPEG(append(testData, byte(i%256)))
 		if err := os.WriteFile(testFile, updatedData, 0644); err != nil {
 			b.Fatalf("Failed to update file: %v", err)
 		}
@@ -178,7 +225,7 @@ func TestMemoryUsageUnderLoad(t *testing.T) {
 	tmpDir := t.TempDir()
 	testFile := filepath.Join(tmpDir, "memory_test.jpg")
 
-	largeImageData := bytes.Repeat([]byte("LARGE_IMAGE_PIXEL_DATA"), 50000)
+	largeImageData := testutil.WrapJPEG(bytes.Repeat([]byte("LARGE_IMAGE_PIXEL_DATA"), 50000))
 	if err := os.WriteFile(testFile, largeImageData, 0644); err != nil {
 		t.Fatalf("Failed to create large test file: %v", err)
 	}
@@ -233,7 +280,7 @@ func TestSystemStabilityUnder30FPS(t *testing.T) {
 	testFile := filepath.Join(tmpDir, "fps_test.jpg")
 
 	baseData := bytes.Repeat([]byte("30FPS_TEST"), 1000)
-	if err := os.WriteFile(testFile, baseData, 0644); err != nil {
+	if err := os.WriteFile(testFile, testutil.WrapJPEG(baseData), 0644); err != nil {
 		t.Fatalf("Failed to create test file: %v", err)
 	}
 
@@ -249,7 +296,7 @@ func TestSystemStabilityUnder30FPS(t *testing.T) {
 	start := time.Now()
 
 	for i := 0; i < updates; i++ {
-		updatedData := append(baseData, []byte(fmt.Sprintf("_FRAME_%d", i))...)
+		updatedData := testutil.WrapJPEG(append(baseData, []byte(fmt.Sprintf("_FRAME_%d", i))...))
 		if err := os.WriteFile(testFile, updatedData, 0644); err != nil {
 			t.Fatalf("Failed to update file at frame %d: %v", i, err)
 		}
@@ -1,23 +1,98 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/bs-frame-monitor/internal/cache"
+	"github.com/bs-frame-monitor/internal/imaging"
+	"github.com/bs-frame-monitor/internal/ingest"
 	"github.com/bs-frame-monitor/internal/monitor"
+	"github.com/bs-frame-monitor/internal/overlay"
 	"github.com/bs-frame-monitor/internal/server"
 )
 
+// streamFlags collects repeated -stream name=path flags.
+type streamFlags []streamSpec
+
+type streamSpec struct {
+	name string
+	path string
+}
+
+func (f *streamFlags) String() string {
+	specs := make([]string, len(*f))
+	for i, spec := range *f {
+		specs[i] = spec.name + "=" + spec.path
+	}
+	return strings.Join(specs, ",")
+}
+
+func (f *streamFlags) Set(value string) error {
+	name, path, ok := strings.Cut(value, "=")
+	if !ok || path == "" {
+		return fmt.Errorf("expected name=path, got %q", value)
+	}
+	if !server.ValidStreamName(name) {
+		return fmt.Errorf("invalid stream name %q (use letters, digits, '-' and '_')", name)
+	}
+	if name == server.DefaultStreamName {
+		return fmt.Errorf("stream name %q is reserved for -file", name)
+	}
+	for _, spec := range *f {
+		if spec.name == name {
+			return fmt.Errorf("duplicate stream name %q", name)
+		}
+	}
+	*f = append(*f, streamSpec{name: name, path: path})
+	return nil
+}
+
+func (f *streamFlags) paths() []string {
+	paths := make([]string, len(*f))
+	for i, spec := range *f {
+		paths[i] = spec.path
+	}
+	return paths
+}
+
 func main() {
+	var streams streamFlags
+	flag.Var(&streams, "stream", "Additional named stream as name=path, served at /streams/{name}/; path may also be stdin, fifo:/path, unix:/path, shm:/path or http (repeatable)")
+
 	var (
-		port     = flag.Int("port", 8080, "HTTP server port")
-		filePath = flag.String("file", "/tmp/output.jpg", "Path to image file to monitor")
-		debug    = flag.Bool("debug", false, "Enable debug logging")
+		port       = flag.Int("port", 8080, "HTTP server port")
+		filePath   = flag.String("file", "/tmp/output.jpg", "Path to image file to monitor, or a directory or glob of numbered frames")
+		sourceSpec = flag.String("source", "file", "Source of the default stream: file (watch -file), stdin or fifo:/path for a raw MJPEG byte stream, unix:/path for a frame socket, shm:/path for a shared-memory ring, or http for frames pushed to /ingest only")
+		debug      = flag.Bool("debug", false, "Enable debug logging")
+		history    = flag.Int("history", 30, "Number of recent frames to keep in history")
+		historyMB  = flag.Int("history-mb", 64, "Memory budget for frame history in megabytes (0 for no limit)")
+		watchMode  = flag.String("watch-mode", "fsnotify", "How to watch the file: fsnotify, poll or hybrid (falls back to poll if inotify fails)")
+		pollEvery  = flag.Duration("poll-interval", 33*time.Millisecond, "File polling interval for the poll and hybrid watch modes")
+		seqOrder   = flag.String("sequence-order", "name", "Newest frame in a directory or glob: name or mtime")
+		cleanup    = flag.Bool("cleanup", false, "Delete older frames from a directory or glob once a newer one is cached")
+		validate   = flag.String("validate", "markers", "JPEG validation before caching: none, markers (SOI/EOI) or decode")
+		quality    = flag.Int("transcode-quality", imaging.DefaultTranscodeQuality, "JPEG quality (1-100) for PNG, GIF, BMP, TIFF and WebP inputs, which are transcoded before caching")
+		staleAfter = flag.Duration("stale-after", 5*time.Second, "Report the source as stale when no frame arrives for this long (0 to disable)")
+		slatePath  = flag.String("slate", "", "JPEG to serve when no frame is available or the source is stale (default: generated slate)")
+		shmPoll    = flag.Duration("shm-poll-interval", 5*time.Millisecond, "How often a shared-memory ring source checks for a new frame")
+		ingestKey  = flag.String("ingest-token", "", "Enable the /ingest endpoints for pushed frames, authorised by this bearer token")
+		maxFrameMB = flag.Int("max-frame-mb", 16, "Largest frame accepted from stdin, FIFO, socket and /ingest sources in megabytes")
+		keepalive  = flag.Duration("keepalive", 10*time.Second, "Resend the current frame to idle video clients at this interval (0 to disable)")
+		sidecar    = flag.String("sidecar", "", "JSON metadata file watched alongside a file source and stored with the frame closest to it in time, served by /metadata and /video?meta=1; a relative name is resolved next to the watched file")
+		overlayMap = flag.String("overlay-fields", "", "Where ?overlay=detections finds detections in the sidecar JSON, e.g. \"detections=faces,box=bbox,box_format=xyxy,label=name,confidence=score,gaze=gaze\" (default: detections, box, label, confidence and gaze)")
+		sideSkew   = flag.Duration("sidecar-max-skew", monitor.DefaultSidecarMaxSkew, "Largest difference in modification time at which a sidecar is paired with a frame")
+		transform  = flag.String("transform", "", "Default transform for every stream's /image and /video, in their query syntax, e.g. \"rotate=90\" for portrait displays")
+		maxFPS     = flag.Float64("max-fps", 0, "Highest frame rate sent to any video client, including those asking for more with ?fps= (0 for no limit)")
 	)
 	flag.Parse()
 
@@ -25,26 +100,172 @@ func main() {
 		log.SetFlags(log.LstdFlags | log.Lshortfile)
 	}
 
-	imageCache := cache.NewImageCache()
-	fileMonitor := monitor.NewFileMonitor(*filePath, imageCache, time.Millisecond*33)
+	mode, err := monitor.ParseWatchMode(*watchMode)
+	if err != nil {
+		log.Fatalf("Invalid -watch-mode: %v", err)
+	}
+
+	validation, err := imaging.ParseValidationLevel(*validate)
+	if err != nil {
+		log.Fatalf("Invalid -validate: %v", err)
+	}
+
+	if *quality < 1 || *quality > 100 {
+		log.Fatalf("Invalid -transcode-quality %d (want 1-100)", *quality)
+	}
+	defaultTransform, err := server.ParseTransform(*transform)
+	if err != nil {
+		log.Fatalf("Invalid -transform: %v", err)
+	}
+	if !defaultTransform.IsZero() {
+		log.Printf("Applying default transform %q to every stream", *transform)
+	}
+	overlayFields, err := overlay.ParseFields(*overlayMap)
+	if err != nil {
+		log.Fatalf("Invalid -overlay-fields: %v", err)
+	}
+	if *maxFPS < 0 {
+		log.Fatalf("Invalid -max-fps %g (want 0 or more)", *maxFPS)
+	}
+
+	order, err := monitor.ParseSequenceOrder(*seqOrder)
+	if err != nil {
+		log.Fatalf("Invalid -sequence-order: %v", err)
+	}
+
+	defaultSource := *sourceSpec
+	switch {
+	case defaultSource == "file":
+		defaultSource = *filePath
+	case defaultSource == "stdin", defaultSource == "http",
+		strings.HasPrefix(defaultSource, "fifo:"), strings.HasPrefix(defaultSource, "unix:"),
+		strings.HasPrefix(defaultSource, "shm:"):
+	default:
+		log.Fatalf("Invalid -source %q (want file, stdin, fifo:/path, unix:/path, shm:/path or http)", *sourceSpec)
+	}
+	stdinUsers := 0
+	for _, path := range append([]string{defaultSource}, streams.paths()...) {
+		if path == "stdin" {
+			stdinUsers++
+		}
+	}
+	if stdinUsers > 1 {
+		log.Fatalf("stdin can only be the source of one stream")
+	}
+
+	// Stopped on shutdown, which removes the socket and unmaps the rings
+	var sources []interface{ Stop() }
+
+	maxFrameSize := *maxFrameMB * 1024 * 1024
 
-	fileMonitor.Start()
-	defer fileMonitor.Stop()
+	// watchSource starts a file monitor for path, an MJPEG stream reader if
+	// path is stdin or fifo:/path, a socket listener for unix:/path or a ring
+	// reader for shm:/path. An http source is fed only by /ingest.
+	watchSource := func(path string) *cache.ImageCache {
+		imageCache := cache.NewImageCacheWithHistory(*history, int64(*historyMB)*1024*1024)
+		imageCache.SetStaleThreshold(*staleAfter)
 
-	srv := server.NewServer(*port, imageCache)
+		ingestOpts := []ingest.Option{
+			ingest.WithValidation(validation),
+			ingest.WithTranscodeQuality(*quality),
+			ingest.WithMaxFrameSize(maxFrameSize),
+		}
+		switch {
+		case path == "http":
+			if *ingestKey == "" {
+				log.Fatalf("An http source requires -ingest-token")
+			}
+			imageCache.SetSource("http")
+		case path == "stdin":
+			source := ingest.NewStdinSource(imageCache, ingestOpts...)
+			source.Start()
+			sources = append(sources, source)
+		case strings.HasPrefix(path, "unix:"):
+			source := ingest.NewSocketSource(strings.TrimPrefix(path, "unix:"), imageCache, ingestOpts...)
+			if err := source.Start(); err != nil {
+				log.Fatalf("Failed to start socket source: %v", err)
+			}
+			sources = append(sources, source)
+		case strings.HasPrefix(path, "shm:"):
+			source := ingest.NewShmSource(strings.TrimPrefix(path, "shm:"), imageCache,
+				append(ingestOpts, ingest.WithPollInterval(*shmPoll))...)
+			source.Start()
+			sources = append(sources, source)
+		case strings.HasPrefix(path, "fifo:"):
+			source := ingest.NewFIFOSource(strings.TrimPrefix(path, "fifo:"), imageCache, ingestOpts...)
+			source.Start()
+			sources = append(sources, source)
+		default:
+			fileMonitor := monitor.NewFileMonitor(path, imageCache, *pollEvery,
+				monitor.WithWatchMode(mode),
+				monitor.WithValidation(validation),
+				monitor.WithTranscodeQuality(*quality),
+				monitor.WithSequenceOrder(order),
+				monitor.WithCleanup(*cleanup),
+				monitor.WithSidecar(sidecarPath(path, *sidecar)),
+				monitor.WithSidecarMaxSkew(*sideSkew))
+			fileMonitor.Start()
+			sources = append(sources, fileMonitor)
+		}
+		return imageCache
+	}
+
+	imageCache := watchSource(defaultSource)
+
+	serverOpts := []server.Option{
+		server.WithKeepalive(*keepalive),
+		server.WithMaxFPS(*maxFPS),
+		server.WithDefaultTransform(defaultTransform),
+		server.WithOverlayFields(overlayFields),
+		server.WithIngestToken(*ingestKey),
+		server.WithMaxFrameSize(maxFrameSize),
+		server.WithValidation(validation),
+		server.WithTranscodeQuality(*quality),
+	}
+	for _, spec := range streams {
+		serverOpts = append(serverOpts, server.WithStream(spec.name, watchSource(spec.path)))
+		log.Printf("Serving stream %q from %s", spec.name, spec.path)
+	}
+	if *slatePath != "" {
+		slate, err := os.ReadFile(*slatePath)
+		if err != nil {
+			log.Fatalf("Failed to read slate image: %v", err)
+		}
+		serverOpts = append(serverOpts, server.WithSlateImage(slate))
+	}
+
+	srv := server.NewServer(*port, imageCache, serverOpts...)
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
+	done := make(chan struct{})
 	go func() {
 		<-c
 		log.Println("Shutting down gracefully...")
 		srv.Shutdown()
-		os.Exit(0)
+		for _, source := range sources {
+			source.Stop()
+		}
+		close(done)
 	}()
 
-	log.Printf("Starting bs-image-stream-server on port %d, monitoring %s", *port, *filePath)
-	if err := srv.Start(); err != nil {
+	log.Printf("Starting bs-image-stream-server on port %d, monitoring %s", *port, defaultSource)
+	if err := srv.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Server failed to start: %v", err)
 	}
+	<-done
+}
+
+// sidecarPath resolves the -sidecar name for a watched file, directory or
+// glob. Relative names are placed next to the watched file or inside the
+// watched directory.
+func sidecarPath(watched, name string) string {
+	if name == "" || filepath.IsAbs(name) {
+		return name
+	}
+	if stat, err := os.Stat(watched); err == nil && stat.IsDir() {
+		return filepath.Join(watched, name)
+	}
+	return filepath.Join(filepath.Dir(watched), name)
 }
@@ -0,0 +1,200 @@
+// Package framesock implements the length-prefixed frame protocol accepted
+// on the server's Unix socket source, along with a small client for
+// producers written in Go.
+//
+// Each message is a fixed 12-byte prefix followed by an optional JSON
+// metadata header and the JPEG itself:
+//
+//	offset  size  field
+//	0       4     magic "BSF1"
+//	4       4     header length in bytes, big-endian uint32 (0 for none)
+//	8       4     frame length in bytes, big-endian uint32
+//	12      n     JSON metadata header, see Metadata
+//	12+n    m     JPEG frame
+//
+// Messages follow each other on the connection with nothing in between.
+package framesock
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Magic starts every message.
+const Magic = "BSF1"
+
+const prefixSize = 12
+
+// MaxHeaderSize bounds the JSON metadata header.
+const MaxHeaderSize = 64 * 1024
+
+var (
+	// ErrBadMagic means the stream is out of sync; the connection cannot be
+	// recovered and should be closed.
+	ErrBadMagic = errors.New("framesock: bad message magic")
+	// ErrFrameTooLarge is returned by Reader.Next for a frame over the
+	// reader's limit. The frame is skipped, so Next can be called again.
+	ErrFrameTooLarge = errors.New("framesock: frame exceeds maximum size")
+	// ErrHeaderTooLarge means the metadata header exceeds MaxHeaderSize.
+	ErrHeaderTooLarge = errors.New("framesock: metadata header too large")
+)
+
+// Metadata is the optional JSON header sent with a frame. Unknown fields
+// are ignored by the server.
+type Metadata struct {
+	// Producer names the sender in the server's health report. It only
+	// needs to be sent once per connection.
+	Producer string `json:"producer,omitempty"`
+	// TimestampNs is the capture time in nanoseconds since the Unix epoch.
+	// The server uses its receive time when it is zero.
+	TimestampNs int64 `json:"timestamp_ns,omitempty"`
+}
+
+// Message is one decoded frame and its raw metadata header.
+type Message struct {
+	Header []byte
+	Frame  []byte
+}
+
+// Metadata decodes the message header. A message without a header yields
+// zero Metadata.
+func (m Message) Metadata() (Metadata, error) {
+	var meta Metadata
+	if len(m.Header) == 0 {
+		return meta, nil
+	}
+	if err := json.Unmarshal(m.Header, &meta); err != nil {
+		return meta, fmt.Errorf("framesock: invalid metadata header: %w", err)
+	}
+	return meta, nil
+}
+
+// WriteMessage writes one message to w. header may be nil.
+func WriteMessage(w io.Writer, header, frame []byte) error {
+	if len(header) > MaxHeaderSize {
+		return ErrHeaderTooLarge
+	}
+	var prefix [prefixSize]byte
+	copy(prefix[:4], Magic)
+	binary.BigEndian.PutUint32(prefix[4:8], uint32(len(header)))
+	binary.BigEndian.PutUint32(prefix[8:12], uint32(len(frame)))
+
+	// One writev on sockets instead of a syscall per part
+	buffers := net.Buffers{prefix[:], header, frame}
+	_, err := buffers.WriteTo(w)
+	return err
+}
+
+// Reader decodes messages from a stream.
+type Reader struct {
+	r            *bufio.Reader
+	maxFrameSize int
+	buf          []byte
+}
+
+func NewReader(r io.Reader, maxFrameSize int) *Reader {
+	return &Reader{
+		r:            bufio.NewReaderSize(r, 64*1024),
+		maxFrameSize: maxFrameSize,
+	}
+}
+
+// Next returns the next message. The returned slices are only valid until
+// the following call. At a clean end of stream Next returns io.EOF.
+func (r *Reader) Next() (Message, error) {
+	var prefix [prefixSize]byte
+	if _, err := io.ReadFull(r.r, prefix[:]); err != nil {
+		return Message{}, err
+	}
+	if string(prefix[:4]) != Magic {
+		return Message{}, ErrBadMagic
+	}
+	headerLen := int(binary.BigEndian.Uint32(prefix[4:8]))
+	frameLen := int(binary.BigEndian.Uint32(prefix[8:12]))
+
+	if headerLen > MaxHeaderSize {
+		return Message{}, ErrHeaderTooLarge
+	}
+	if r.maxFrameSize > 0 && frameLen > r.maxFrameSize {
+		// Skip the message so the stream stays in sync
+		if _, err := r.r.Discard(headerLen + frameLen); err != nil {
+			return Message{}, unexpectedEOF(err)
+		}
+		return Message{}, ErrFrameTooLarge
+	}
+
+	if cap(r.buf) < headerLen+frameLen {
+		r.buf = make([]byte, headerLen+frameLen)
+	}
+	r.buf = r.buf[:headerLen+frameLen]
+	if _, err := io.ReadFull(r.r, r.buf); err != nil {
+		return Message{}, unexpectedEOF(err)
+	}
+	return Message{Header: r.buf[:headerLen], Frame: r.buf[headerLen:]}, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Client sends frames to a server's Unix socket source. It is safe for
+// concurrent use.
+type Client struct {
+	conn     net.Conn
+	producer string
+
+	mu         sync.Mutex
+	sentHeader bool
+}
+
+// Dial connects to the socket at path. producer names this client in the
+// server's health report and may be empty.
+func Dial(path, producer string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, producer: producer}, nil
+}
+
+// Send writes a frame stamped with the current time.
+func (c *Client) Send(frame []byte) error {
+	return c.SendWithMetadata(frame, Metadata{TimestampNs: time.Now().UnixNano()})
+}
+
+// SendWithMetadata writes a frame with the given metadata. The client's
+// producer name is added to the first frame it sends.
+func (c *Client) SendWithMetadata(frame []byte, meta Metadata) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.sentHeader && meta.Producer == "" {
+		meta.Producer = c.producer
+	}
+	var header []byte
+	if meta != (Metadata{}) {
+		var err error
+		if header, err = json.Marshal(meta); err != nil {
+			return err
+		}
+	}
+	if err := WriteMessage(c.conn, header, frame); err != nil {
+		return err
+	}
+	c.sentHeader = true
+	return nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,116 @@
+package framesock
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteReadMessages(t *testing.T) {
+	var buf bytes.Buffer
+	WriteMessage(&buf, []byte(`{"producer":"gaze"}`), []byte("frame one"))
+	WriteMessage(&buf, nil, []byte("frame two"))
+
+	r := NewReader(&buf, 0)
+
+	msg, err := r.Next()
+	if err != nil {
+		t.Fatalf("Failed to read first message: %v", err)
+	}
+	meta, err := msg.Metadata()
+	if err != nil || meta.Producer != "gaze" || string(msg.Frame) != "frame one" {
+		t.Errorf("Unexpected first message: %q %+v %v", msg.Frame, meta, err)
+	}
+
+	msg, err = r.Next()
+	if err != nil {
+		t.Fatalf("Failed to read second message: %v", err)
+	}
+	if meta, _ := msg.Metadata(); meta != (Metadata{}) || string(msg.Frame) != "frame two" {
+		t.Errorf("Unexpected second message: %q %+v", msg.Frame, meta)
+	}
+
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF at end of stream, got %v", err)
+	}
+}
+
+func TestReaderSkipsOversizedFrames(t *testing.T) {
+	var buf bytes.Buffer
+	WriteMessage(&buf, []byte(`{}`), bytes.Repeat([]byte("x"), 100))
+	WriteMessage(&buf, nil, []byte("small"))
+
+	r := NewReader(&buf, 10)
+	if _, err := r.Next(); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("Expected ErrFrameTooLarge, got %v", err)
+	}
+	msg, err := r.Next()
+	if err != nil || string(msg.Frame) != "small" {
+		t.Errorf("Reader should stay in sync after an oversized frame, got %q %v", msg.Frame, err)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	r := NewReader(bytes.NewReader([]byte("JUNKJUNKJUNK")), 0)
+	if _, err := r.Next(); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("Expected ErrBadMagic, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	WriteMessage(&buf, nil, []byte("truncated frame"))
+	r = NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-3]), 0)
+	if _, err := r.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frames.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan []Metadata, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var metas []Metadata
+		r := NewReader(conn, 0)
+		for {
+			msg, err := r.Next()
+			if err != nil {
+				received <- metas
+				return
+			}
+			meta, _ := msg.Metadata()
+			metas = append(metas, meta)
+		}
+	}()
+
+	client, err := Dial(path, "gaze")
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	client.Send([]byte("one"))
+	client.Send([]byte("two"))
+	client.Close()
+
+	metas := <-received
+	if len(metas) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(metas))
+	}
+	if metas[0].Producer != "gaze" || metas[1].Producer != "" {
+		t.Errorf("Producer name should only be sent with the first frame, got %+v", metas)
+	}
+	if metas[0].TimestampNs == 0 || metas[1].TimestampNs < metas[0].TimestampNs {
+		t.Errorf("Frames should carry increasing timestamps, got %+v", metas)
+	}
+}
@@ -0,0 +1,280 @@
+// Package shmring implements a single-producer shared-memory ring of JPEG
+// frames, normally placed in /dev/shm, that the server's shm source reads
+// without opening a file per frame.
+//
+// The file is created by the producer and laid out as follows. All integers
+// are little-endian; sequence fields are 64-bit aligned and updated
+// atomically.
+//
+//	Header (64 bytes)
+//	offset  size  field
+//	0       4     magic "BSRB"
+//	4       4     version, currently 1
+//	8       4     slot count
+//	12      4     slot size in bytes (maximum frame size)
+//	16      8     write sequence: sequence number of the newest complete
+//	              frame, 0 before the first frame
+//	24      40    reserved
+//
+//	Slot descriptors (32 bytes each, one per slot, starting at offset 64)
+//	0       8     sequence number of the frame in the slot, 0 while the
+//	              slot is being written
+//	8       8     offset of the slot's data from the start of the file
+//	16      4     length of the frame in bytes
+//	20      4     reserved
+//	24      8     capture time in nanoseconds since the Unix epoch
+//
+//	Slot data follows the descriptors, aligned to 64 bytes.
+//
+// Frame n (starting at 1) is written to slot n % slot count. The writer
+// zeroes the slot's sequence, copies the frame, fills in the length and
+// time, stores the slot sequence and finally the write sequence. A reader
+// loads the write sequence, copies the slot and re-checks the slot sequence
+// afterwards; a mismatch means the writer lapped the reader mid-copy and the
+// frame is discarded.
+package shmring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	Magic   = "BSRB"
+	Version = 1
+
+	headerSize     = 64
+	descriptorSize = 32
+	dataAlign      = 64
+
+	offWriteSeq = 16
+
+	descSeq       = 0
+	descOffset    = 8
+	descLength    = 16
+	descTimestamp = 24
+)
+
+var (
+	ErrInvalidRing   = errors.New("shmring: not a frame ring")
+	ErrFrameTooLarge = errors.New("shmring: frame exceeds slot size")
+)
+
+// Frame is one frame read from the ring.
+type Frame struct {
+	Seq        uint64
+	CapturedAt time.Time
+	Data       []byte
+}
+
+type ring struct {
+	file     *os.File
+	mem      []byte
+	slots    uint32
+	slotSize uint32
+}
+
+func (r *ring) seqAt(off int) *uint64 {
+	return (*uint64)(unsafe.Pointer(&r.mem[off]))
+}
+
+func (r *ring) descriptor(slot uint32) int {
+	return headerSize + int(slot)*descriptorSize
+}
+
+func (r *ring) close() error {
+	err := syscall.Munmap(r.mem)
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func layoutSize(slots, slotSize uint32) (dataStart, total int) {
+	dataStart = align(headerSize+int(slots)*descriptorSize, dataAlign)
+	return dataStart, dataStart + int(slots)*align(int(slotSize), dataAlign)
+}
+
+func align(n, to int) int {
+	return (n + to - 1) / to * to
+}
+
+func mmap(file *os.File, size int, prot int) ([]byte, error) {
+	mem, err := syscall.Mmap(int(file.Fd()), 0, size, prot, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("shmring: mmap failed: %w", err)
+	}
+	return mem, nil
+}
+
+// Writer is the producer side of a ring.
+type Writer struct {
+	ring
+	seq uint64
+}
+
+// Create creates or truncates the ring file at path with the given number
+// of slots, each holding frames of up to slotSize bytes. Readers that had
+// the previous file open notice the new one and reopen it.
+func Create(path string, slots, slotSize int) (*Writer, error) {
+	if slots < 2 || slotSize <= 0 {
+		return nil, fmt.Errorf("shmring: need at least 2 slots and a positive slot size")
+	}
+	dataStart, total := layoutSize(uint32(slots), uint32(slotSize))
+
+	// Replace rather than truncate, so readers of an old ring keep a
+	// consistent mapping until they reopen
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(int64(total)); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+	mem, err := mmap(file, total, syscall.PROT_READ|syscall.PROT_WRITE)
+	if err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+
+	w := &Writer{ring: ring{file: file, mem: mem, slots: uint32(slots), slotSize: uint32(slotSize)}}
+	copy(mem[0:4], Magic)
+	binary.LittleEndian.PutUint32(mem[4:8], Version)
+	binary.LittleEndian.PutUint32(mem[8:12], uint32(slots))
+	binary.LittleEndian.PutUint32(mem[12:16], uint32(slotSize))
+	for i := uint32(0); i < w.slots; i++ {
+		d := w.descriptor(i)
+		offset := dataStart + int(i)*align(slotSize, dataAlign)
+		binary.LittleEndian.PutUint64(mem[d+descOffset:], uint64(offset))
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		w.close()
+		os.Remove(tmp)
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write publishes a frame captured at capturedAt and returns its sequence
+// number.
+func (w *Writer) Write(frame []byte, capturedAt time.Time) (uint64, error) {
+	if len(frame) > int(w.slotSize) {
+		return 0, ErrFrameTooLarge
+	}
+
+	w.seq++
+	slot := uint32(w.seq % uint64(w.slots))
+	d := w.descriptor(slot)
+	offset := binary.LittleEndian.Uint64(w.mem[d+descOffset:])
+
+	atomic.StoreUint64(w.seqAt(d+descSeq), 0)
+	copy(w.mem[offset:], frame)
+	binary.LittleEndian.PutUint32(w.mem[d+descLength:], uint32(len(frame)))
+	binary.LittleEndian.PutUint64(w.mem[d+descTimestamp:], uint64(capturedAt.UnixNano()))
+	atomic.StoreUint64(w.seqAt(d+descSeq), w.seq)
+	atomic.StoreUint64(w.seqAt(offWriteSeq), w.seq)
+	return w.seq, nil
+}
+
+// Close unmaps the ring. The file is left in place for readers; remove it
+// to signal that the producer has gone away.
+func (w *Writer) Close() error {
+	return w.close()
+}
+
+// Reader is the consumer side of a ring.
+type Reader struct {
+	ring
+	stat    os.FileInfo
+	lastSeq uint64
+}
+
+// Open maps an existing ring file read-only.
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if stat.Size() < headerSize {
+		file.Close()
+		return nil, ErrInvalidRing
+	}
+
+	mem, err := mmap(file, int(stat.Size()), syscall.PROT_READ)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r := &Reader{ring: ring{file: file, mem: mem}, stat: stat}
+	if string(mem[0:4]) != Magic || binary.LittleEndian.Uint32(mem[4:8]) != Version {
+		r.close()
+		return nil, ErrInvalidRing
+	}
+	r.slots = binary.LittleEndian.Uint32(mem[8:12])
+	r.slotSize = binary.LittleEndian.Uint32(mem[12:16])
+	if _, total := layoutSize(r.slots, r.slotSize); r.slots < 2 || int64(total) > stat.Size() {
+		r.close()
+		return nil, ErrInvalidRing
+	}
+	return r, nil
+}
+
+// Replaced reports whether the file at path is no longer the ring this
+// reader has mapped, because the producer recreated or removed it.
+func (r *Reader) Replaced(path string) bool {
+	stat, err := os.Stat(path)
+	return err != nil || !os.SameFile(stat, r.stat)
+}
+
+// Next copies the newest frame into buf if it is newer than the last frame
+// returned, reusing buf's storage. It reports false when there is no new
+// frame, or when the writer overwrote the slot during the copy; the next
+// call tries again.
+func (r *Reader) Next(buf []byte) (Frame, bool) {
+	seq := atomic.LoadUint64(r.seqAt(offWriteSeq))
+	if seq == r.lastSeq {
+		return Frame{}, false
+	}
+	if seq < r.lastSeq {
+		// The producer restarted its sequence in the same file
+		r.lastSeq = 0
+	}
+
+	d := r.descriptor(uint32(seq % uint64(r.slots)))
+	if atomic.LoadUint64(r.seqAt(d+descSeq)) != seq {
+		return Frame{}, false
+	}
+	offset := binary.LittleEndian.Uint64(r.mem[d+descOffset:])
+	length := binary.LittleEndian.Uint32(r.mem[d+descLength:])
+	timestamp := int64(binary.LittleEndian.Uint64(r.mem[d+descTimestamp:]))
+	if length > r.slotSize || offset+uint64(length) > uint64(len(r.mem)) {
+		return Frame{}, false
+	}
+	data := append(buf[:0], r.mem[offset:offset+uint64(length)]...)
+
+	if atomic.LoadUint64(r.seqAt(d+descSeq)) != seq {
+		return Frame{}, false
+	}
+	r.lastSeq = seq
+	return Frame{Seq: seq, CapturedAt: time.Unix(0, timestamp), Data: data}, true
+}
+
+func (r *Reader) Close() error {
+	return r.close()
+}
@@ -0,0 +1,95 @@
+package shmring
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frames")
+	w, err := Create(path, 4, 64)
+	if err != nil {
+		t.Fatalf("Failed to create ring: %v", err)
+	}
+	defer w.Close()
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open ring: %v", err)
+	}
+	defer r.Close()
+
+	if _, ok := r.Next(nil); ok {
+		t.Error("Empty ring should have no frame")
+	}
+
+	captured := time.Now().Truncate(time.Microsecond)
+	w.Write([]byte("frame 1"), captured)
+
+	frame, ok := r.Next(nil)
+	if !ok || string(frame.Data) != "frame 1" || frame.Seq != 1 || !frame.CapturedAt.Equal(captured) {
+		t.Fatalf("Unexpected frame %+v (ok=%v)", frame, ok)
+	}
+	if _, ok := r.Next(nil); ok {
+		t.Error("The same frame should not be returned twice")
+	}
+
+	// A reader that falls behind skips straight to the newest frame
+	for i := 2; i <= 10; i++ {
+		w.Write([]byte(fmt.Sprintf("frame %d", i)), time.Now())
+	}
+	frame, ok = r.Next(make([]byte, 0, 64))
+	if !ok || string(frame.Data) != "frame 10" || frame.Seq != 10 {
+		t.Errorf("Expected newest frame, got %q seq %d", frame.Data, frame.Seq)
+	}
+
+	if _, err := w.Write(make([]byte, 65), time.Now()); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("Expected ErrFrameTooLarge, got %v", err)
+	}
+}
+
+func TestReaderDetectsReplacement(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frames")
+	w, err := Create(path, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create ring: %v", err)
+	}
+	w.Write([]byte("old"), time.Now())
+	w.Close()
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open ring: %v", err)
+	}
+	defer r.Close()
+	if r.Replaced(path) {
+		t.Error("Ring should not be reported as replaced")
+	}
+
+	w, err = Create(path, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to recreate ring: %v", err)
+	}
+	defer w.Close()
+	if !r.Replaced(path) {
+		t.Error("Recreated ring should be reported as replaced")
+	}
+
+	os.Remove(path)
+	if !r.Replaced(path) {
+		t.Error("Removed ring should be reported as replaced")
+	}
+}
+
+func TestOpenRejectsInvalidFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frames")
+	os.WriteFile(path, make([]byte, 128), 0644)
+
+	if _, err := Open(path); !errors.Is(err, ErrInvalidRing) {
+		t.Errorf("Expected ErrInvalidRing, got %v", err)
+	}
+}